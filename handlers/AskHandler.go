@@ -4,15 +4,16 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+	"github.com/RINOHeinrich1/postgres-vectorizer/middlewares"
 )
 
-type SearchRequest struct {
-	Query string `json:"query"`
-	TopK  int    `json:"top_k"` // optionnel
-}
-
 func AskHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
 	// Décoder la requête
 	var req SearchRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -21,29 +22,25 @@ func AskHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if req.Query == "" {
-		http.Error(w, "Le champ 'query' est requis", http.StatusBadRequest)
-		return
-	}
-	if req.TopK == 0 {
-		req.TopK = 5 // Valeur par défaut
-	}
-
-	// Générer l'embedding
-	vector, err := utils.Embed(req.Query)
-	if err != nil {
-		http.Error(w, "Erreur génération vecteur : "+err.Error(), http.StatusInternalServerError)
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Recherche dans Qdrant
-	results, err := utils.SearchQdrant(vector, req.TopK)
+	results, groups, err := runSearch(r.Context(), userID, &req)
 	if err != nil {
-		http.Error(w, "Erreur recherche Qdrant : "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Réponse JSON
 	w.Header().Set("Content-Type", "application/json")
+	if req.GroupBy != "" {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"group_by": req.GroupBy,
+			"groups":   groups,
+		})
+		return
+	}
 	json.NewEncoder(w).Encode(results)
 }
@@ -5,9 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"strconv"
 
-	_ "github.com/lib/pq"
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
 func ExecuteSQLHandler(w http.ResponseWriter, r *http.Request) {
@@ -24,6 +25,15 @@ func ExecuteSQLHandler(w http.ResponseWriter, r *http.Request) {
 		DBName   string `json:"dbname"`
 		SSLMode  string `json:"ssl_mode"`
 		SQL      string `json:"sql"`
+		MaxRows  int    `json:"max_rows"` // optionnel, plafonné par SQL_MAX_ROWS
+		// Valeurs liées aux placeholders $1..$n, brutes ou {"value", "type"}
+		Params []utils.SQLParam `json:"params"`
+		// json, ndjson, csv ou arrow ; sinon déduit de l'en-tête Accept
+		Format string `json:"format"`
+		// Retourne le plan estimé (EXPLAIN) sans exécuter la requête
+		Explain bool `json:"explain"`
+		// Plafond de coût estimé, sans dépasser SQL_MAX_COST s'il est défini
+		MaxCost float64 `json:"max_cost"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
@@ -36,8 +46,19 @@ func ExecuteSQLHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(params.SQL)), "SELECT") {
-		http.Error(w, "Seules les requêtes SELECT sont autorisées", http.StatusForbidden)
+	if params.MaxRows < 0 || params.MaxCost < 0 {
+		http.Error(w, "max_rows et max_cost doivent être positifs", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.CheckReadOnlySQL(params.SQL); err != nil {
+		writeSQLSafetyError(w, err)
+		return
+	}
+
+	query, args, err := utils.BindSQLParams(params.SQL, params.Params)
+	if err != nil {
+		http.Error(w, "Paramètres invalides : "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -48,53 +69,95 @@ func ExecuteSQLHandler(w http.ResponseWriter, r *http.Request) {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		params.Host, params.Port, params.User, params.Password, params.DBName, params.SSLMode)
 
-	db, err := sql.Open("postgres", connStr)
+	// pgx : la description des lignes donne l'OID et la nullabilité des colonnes
+	db, err := sql.Open("pgx", connStr)
 	if err != nil {
 		http.Error(w, "Erreur ouverture DB: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	defer db.Close()
 
-	rows, err := db.Query(params.SQL)
-	if err != nil {
-		http.Error(w, "Erreur exécution requête: "+err.Error(), http.StatusInternalServerError)
+	limits := utils.DefaultQueryLimits().WithMaxRows(params.MaxRows).WithMaxCost(params.MaxCost)
+	if params.Explain {
+		plan, err := utils.ExplainReadOnlyQuery(r.Context(), db, query, limits, args...)
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(plan)
 		return
 	}
-	defer rows.Close()
 
-	columns, err := rows.Columns()
-	if err != nil {
-		http.Error(w, "Erreur récupération colonnes: "+err.Error(), http.StatusInternalServerError)
+	var format utils.ResultFormat
+	if params.Format != "" {
+		var err error
+		if format, err = utils.ParseResultFormat(params.Format); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var ok bool
+		if format, ok = utils.NegotiateResultFormat(r.Header.Get("Accept")); !ok {
+			http.Error(w, "Format non supporté : application/json, application/x-ndjson, text/csv ou application/vnd.apache.arrow.stream", http.StatusNotAcceptable)
+			return
+		}
+	}
+
+	// Transaction en lecture seule, bornée en durée, en nombre de lignes et
+	// en coût estimé, dont les lignes sont écrites au fil de la lecture
+	body := &sentWriter{ResponseWriter: w}
+	out := &httpResultWriter{ResultWriter: utils.NewResultWriter(format, body), w: w, format: format}
+	summary, err := utils.StreamReadOnlyQuery(r.Context(), db, query, limits, out, args...)
+	if err != nil && !out.started {
+		writeQueryError(w, err)
 		return
 	}
 
-	var results []map[string]interface{}
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
+	// Le résumé et l'erreur éventuelle sont ajoutés en fin de flux et dans
+	// les trailers HTTP. Si le résultat tient encore dans les tampons des
+	// writers, les en-têtes ne sont pas partis : le résumé y est aussi placé,
+	// seul moyen pour un client CSV sans support des trailers de voir la
+	// troncature.
+	if !body.sent {
+		setSummaryHeaders(w.Header(), summary, err)
+	}
+	out.Close(summary, err)
+	setSummaryHeaders(w.Header(), summary, err)
+}
 
-		for i := range values {
-			valuePtrs[i] = &values[i]
-		}
+func setSummaryHeaders(h http.Header, summary utils.QuerySummary, err error) {
+	h.Set("X-Row-Count", strconv.Itoa(summary.RowCount))
+	h.Set("X-Truncated", strconv.FormatBool(summary.Truncated))
+	if err != nil {
+		h.Set("X-Query-Error", err.Error())
+	}
+}
 
-		if err := rows.Scan(valuePtrs...); err != nil {
-			http.Error(w, "Erreur scan ligne: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+// sentWriter note si le corps de la réponse a commencé, c'est-à-dire si les
+// en-têtes sont partis.
+type sentWriter struct {
+	http.ResponseWriter
+	sent bool
+}
 
-		rowMap := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				rowMap[col] = string(b) // 🟢 convertit les []byte en string
-			} else {
-				rowMap[col] = val
-			}
-		}
+func (s *sentWriter) Write(p []byte) (int, error) {
+	s.sent = true
+	return s.ResponseWriter.Write(p)
+}
 
-		results = append(results, rowMap)
-	}
+// httpResultWriter n'envoie les en-têtes de la réponse qu'à réception des
+// colonnes, pour qu'une erreur survenue avant garde son code HTTP.
+type httpResultWriter struct {
+	utils.ResultWriter
+	w       http.ResponseWriter
+	format  utils.ResultFormat
+	started bool
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+func (h *httpResultWriter) WriteColumns(columns []utils.ColumnMeta) error {
+	h.w.Header().Set("Content-Type", h.format.ContentType())
+	h.w.Header().Set("Trailer", "X-Row-Count, X-Truncated, X-Query-Error")
+	h.started = true
+	return h.ResultWriter.WriteColumns(columns)
 }
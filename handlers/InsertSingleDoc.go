@@ -42,8 +42,16 @@ func InsertSingleDocumentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Un data_id existant est une mise à jour : on retire les anciens points
+	// de la ligne qui ne portent pas l'identifiant déterministe.
+	keepID := utils.PointID(userID, req.Source, req.DataID, 0)
+	if err := utils.DeleteFromQdrantByDataID(userID, req.Source, req.DataID, keepID); err != nil {
+		http.Error(w, "Erreur nettoyage anciens points Qdrant: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Document inséré avec succès",
+		"message": "Document inséré ou mis à jour avec succès",
 	})
 }
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/middlewares"
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+)
+
+// AnswerRequest reprend les options de recherche de /ask et règle la
+// génération de la réponse.
+type AnswerRequest struct {
+	SearchRequest
+
+	Temperature     *float64 `json:"temperature,omitempty"`       // optionnel
+	MaxTokens       int      `json:"max_tokens,omitempty"`        // optionnel
+	MaxContextChars int      `json:"max_context_chars,omitempty"` // optionnel, taille max des extraits
+}
+
+type AnswerResponse struct {
+	Answer    string           `json:"answer"`
+	Model     string           `json:"model,omitempty"`
+	Citations []utils.Citation `json:"citations"`
+}
+
+const noContextAnswer = "Aucun extrait pertinent n'a été trouvé pour répondre à la question."
+
+// validate vérifie une requête /answer ; les erreurs sont destinées au client.
+func (req *AnswerRequest) validate() error {
+	if err := req.SearchRequest.validate(); err != nil {
+		return err
+	}
+	if req.GroupBy != "" {
+		return fmt.Errorf("group_by n'est pas supporté par /answer")
+	}
+	if req.MaxTokens < 0 || req.MaxContextChars < 0 {
+		return fmt.Errorf("max_tokens et max_context_chars doivent être positifs")
+	}
+	// Le prompt a besoin du texte et des références de chaque extrait
+	if len(req.WithPayload) > 0 {
+		for _, field := range []string{"text", "source", "data_id"} {
+			if !slices.Contains(req.WithPayload, field) {
+				req.WithPayload = append(req.WithPayload, field)
+			}
+		}
+	}
+	return nil
+}
+
+// decodeAnswerRequest authentifie, décode et valide une requête /answer. En
+// cas d'échec, la réponse d'erreur est déjà écrite.
+func decodeAnswerRequest(w http.ResponseWriter, r *http.Request) (string, *AnswerRequest, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return "", nil, false
+	}
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return "", nil, false
+	}
+
+	var req AnswerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Requête JSON invalide", http.StatusBadRequest)
+		return "", nil, false
+	}
+	defer r.Body.Close()
+
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", nil, false
+	}
+	return userID, &req, true
+}
+
+// AnswerHandler recherche les extraits pertinents comme /ask puis demande au
+// modèle de langage une réponse citant ses sources.
+func AnswerHandler(w http.ResponseWriter, r *http.Request) {
+	userID, req, ok := decodeAnswerRequest(w, r)
+	if !ok {
+		return
+	}
+
+	llm, err := utils.GetLLM()
+	if err != nil {
+		http.Error(w, "Erreur configuration LLM : "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hits, _, err := runSearch(r.Context(), userID, &req.SearchRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	messages, citations := utils.BuildAnswerPrompt(req.Query, hits, req.MaxContextChars)
+	resp := AnswerResponse{Model: llm.ModelName(), Citations: citations}
+	if len(citations) == 0 {
+		// Inutile d'interroger le modèle sans contexte
+		resp.Answer = noContextAnswer
+	} else {
+		answer, err := llm.Chat(r.Context(), messages, utils.ChatOptions{
+			Temperature: req.Temperature,
+			MaxTokens:   req.MaxTokens,
+		})
+		if err != nil {
+			http.Error(w, "Erreur génération réponse : "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.Answer = answer
+		utils.MarkCitations(answer, resp.Citations)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
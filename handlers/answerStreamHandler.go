@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+)
+
+// sseWriter écrit des événements Server-Sent Events et les pousse
+// immédiatement vers le client.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s sseWriter) send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// AnswerTiming détaille la durée des étapes d'une réponse en flux.
+type AnswerTiming struct {
+	SearchMs     int64 `json:"search_ms"`
+	FirstTokenMs int64 `json:"first_token_ms,omitempty"`
+	GenerationMs int64 `json:"generation_ms"`
+	TotalMs      int64 `json:"total_ms"`
+}
+
+// AnswerStreamHandler est la variante SSE de /answer. Événements émis :
+//   - sources : extraits retenus (citations) et modèle utilisé ;
+//   - token : fragment de réponse {"delta": "..."} ;
+//   - done : usage des tokens, durées et numéros d'extraits cités ;
+//   - error : {"error": "..."} si la génération échoue en cours de route.
+//
+// La déconnexion du client annule la requête vers le modèle.
+func AnswerStreamHandler(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	userID, req, ok := decodeAnswerRequest(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming non supporté", http.StatusInternalServerError)
+		return
+	}
+
+	llm, err := utils.GetLLM()
+	if err != nil {
+		http.Error(w, "Erreur configuration LLM : "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	hits, _, err := runSearch(ctx, userID, &req.SearchRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	searchDone := time.Now()
+	messages, citations := utils.BuildAnswerPrompt(req.Query, hits, req.MaxContextChars)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	sse := sseWriter{w: w, flusher: flusher}
+
+	if err := sse.send("sources", map[string]interface{}{
+		"model":     llm.ModelName(),
+		"citations": citations,
+	}); err != nil {
+		return
+	}
+
+	var answer strings.Builder
+	var usage utils.Usage
+	var firstToken time.Time
+	if len(citations) == 0 {
+		// Inutile d'interroger le modèle sans contexte
+		answer.WriteString(noContextAnswer)
+		if err := sse.send("token", map[string]string{"delta": noContextAnswer}); err != nil {
+			return
+		}
+	} else {
+		usage, err = llm.ChatStream(ctx, messages, utils.ChatOptions{
+			Temperature: req.Temperature,
+			MaxTokens:   req.MaxTokens,
+		}, func(delta string) error {
+			if firstToken.IsZero() {
+				firstToken = time.Now()
+			}
+			answer.WriteString(delta)
+			return sse.send("token", map[string]string{"delta": delta})
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				// Client déconnecté : la requête vers le modèle est annulée
+				return
+			}
+			log.Printf("génération de réponse en flux : %v", err)
+			sse.send("error", map[string]string{"error": "Erreur génération réponse : " + err.Error()})
+			return
+		}
+	}
+
+	utils.MarkCitations(answer.String(), citations)
+	cited := []int{}
+	for _, c := range citations {
+		if c.Cited {
+			cited = append(cited, c.Index)
+		}
+	}
+
+	end := time.Now()
+	timing := AnswerTiming{
+		SearchMs:     searchDone.Sub(start).Milliseconds(),
+		GenerationMs: end.Sub(searchDone).Milliseconds(),
+		TotalMs:      end.Sub(start).Milliseconds(),
+	}
+	if !firstToken.IsZero() {
+		timing.FirstTokenMs = firstToken.Sub(start).Milliseconds()
+	}
+	sse.send("done", map[string]interface{}{
+		"usage":  usage,
+		"timing": timing,
+		"cited":  cited,
+	})
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/middlewares"
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/RINOHeinrich1/postgres-vectorizer/vectorizer"
+)
+
+// POST /cdc/start : abonne la table à un slot de réplication logique
+func StartCDCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CDCRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON invalide: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.SSLMode == "" {
+		req.SSLMode = "disable"
+	}
+	if req.TableName == "" || req.Template == "" {
+		http.Error(w, "table_name et template sont obligatoires", http.StatusBadRequest)
+		return
+	}
+	if _, err := template.New("line").Parse(req.Template); err != nil {
+		http.Error(w, "Erreur parsing template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stream := vectorizer.CDCStream{
+		OwnerID:     userID,
+		Source:      vectorizer.Source(req.FormatRequest),
+		Request:     req.FormatRequest,
+		Slot:        req.SlotName,
+		Publication: req.PublicationName,
+	}
+	if err := vectorizer.CDC.Start(r.Context(), stream); err != nil {
+		http.Error(w, "Erreur démarrage CDC: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Réplication logique démarrée pour %s", stream.Source),
+	})
+}
+
+// POST /cdc/stop : arrête le flux (et supprime le slot si drop vaut true)
+func StopCDCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.StopSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON invalide: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DBName == "" || req.TableName == "" {
+		http.Error(w, "dbname et table_name sont obligatoires", http.StatusBadRequest)
+		return
+	}
+
+	source := fmt.Sprintf("%s/%s", req.DBName, req.TableName)
+	if err := vectorizer.CDC.Stop(r.Context(), userID, source, req.Drop); err != nil {
+		http.Error(w, "Erreur arrêt CDC: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Réplication logique arrêtée pour %s", source),
+	})
+}
+
+// GET /cdc/status : état des flux de l'utilisateur
+func CDCStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
+	statuses, err := vectorizer.CDC.Status(userID)
+	if err != nil {
+		http.Error(w, "Erreur lecture état CDC: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
 )
 
 func GetTablesHandler(w http.ResponseWriter, r *http.Request) {
@@ -42,56 +42,12 @@ func GetTablesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Requête pour récupérer tables et colonnes
-	query := `
-	SELECT
-		c.table_name,
-		c.column_name,
-		c.data_type,
-		c.is_nullable
-	FROM
-		information_schema.columns c
-	JOIN
-		information_schema.tables t
-	ON
-		c.table_name = t.table_name
-	WHERE
-		t.table_schema = 'public'
-		AND t.table_type = 'BASE TABLE'
-	ORDER BY
-		c.table_name, c.ordinal_position;
-	`
-
-	rows, err := db.Query(query)
+	// Tables et colonnes du schéma public
+	tables, err := utils.LoadSchema(r.Context(), db)
 	if err != nil {
-		http.Error(w, "Erreur requête : "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	tablesMap := make(map[string][]models.Column)
-
-	for rows.Next() {
-		var tableName, columnName, dataType, isNullable string
-		if err := rows.Scan(&tableName, &columnName, &dataType, &isNullable); err != nil {
-			http.Error(w, "Erreur scan : "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		tablesMap[tableName] = append(tablesMap[tableName], models.Column{
-			ColumnName: columnName,
-			DataType:   dataType,
-			IsNullable: isNullable,
-		})
-	}
-
-	// Convertir map en slice
-	var tables []models.Table
-	for tn, cols := range tablesMap {
-		tables = append(tables, models.Table{
-			TableName: tn,
-			Columns:   cols,
-		})
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tables)
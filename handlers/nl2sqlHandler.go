@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/middlewares"
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+	"github.com/RINOHeinrich1/postgres-vectorizer/vectorizer"
+)
+
+const (
+	defaultNL2SQLMaxRows = 1000
+	// Nombre de propositions demandées au modèle : une requête refusée ou en
+	// erreur est renvoyée au modèle avec le message pour correction.
+	nl2sqlAttempts = 2
+)
+
+type NL2SQLResponse struct {
+	Question    string `json:"question"`
+	SQL         string `json:"sql"`
+	Explanation string `json:"explanation"`
+	utils.QueryResult
+}
+
+// nl2sqlError porte le statut HTTP d'un échec de runNL2SQL.
+type nl2sqlError struct {
+	status int
+	err    error
+}
+
+func (e *nl2sqlError) Error() string { return e.err.Error() }
+
+// nl2sqlStatus retourne le statut HTTP associé à une erreur de runNL2SQL.
+func nl2sqlStatus(err error) int {
+	var e *nl2sqlError
+	if errors.As(err, &e) {
+		return e.status
+	}
+	return http.StatusInternalServerError
+}
+
+// runNL2SQL charge le schéma, fait proposer une requête au modèle, la vérifie
+// puis l'exécute. Les erreurs retournées sont des *nl2sqlError.
+func runNL2SQL(ctx context.Context, req models.NL2SQLRequest) (*NL2SQLResponse, error) {
+	llm, err := utils.GetLLM()
+	if err != nil {
+		return nil, &nl2sqlError{http.StatusInternalServerError, fmt.Errorf("Erreur configuration LLM : %w", err)}
+	}
+
+	db, err := vectorizer.OpenQueryDB(ctx, req.ConnParams)
+	if err != nil {
+		return nil, &nl2sqlError{http.StatusInternalServerError, err}
+	}
+	defer db.Close()
+
+	tables, err := utils.LoadSchema(ctx, db)
+	if err != nil {
+		return nil, &nl2sqlError{http.StatusInternalServerError, err}
+	}
+	if len(req.Tables) > 0 {
+		tables = slices.DeleteFunc(tables, func(t models.Table) bool {
+			return !slices.Contains(req.Tables, t.TableName)
+		})
+	}
+	if len(tables) == 0 {
+		return nil, &nl2sqlError{http.StatusBadRequest, fmt.Errorf("Aucune table disponible dans le schéma public")}
+	}
+
+	messages := utils.BuildNL2SQLPrompt(req.Question, tables)
+	var lastErr error
+	for attempt := 0; attempt < nl2sqlAttempts; attempt++ {
+		content, err := llm.Chat(ctx, messages, utils.ChatOptions{})
+		if err != nil {
+			return nil, &nl2sqlError{http.StatusBadGateway, fmt.Errorf("Erreur génération SQL : %w", err)}
+		}
+		messages = append(messages, utils.ChatMessage{Role: "assistant", Content: content})
+
+		answer, err := utils.ParseNL2SQLAnswer(content)
+		if err == nil {
+			err = utils.CheckReadOnlySQL(answer.SQL)
+		}
+		if err != nil {
+			lastErr = err
+			messages = append(messages, utils.ChatMessage{Role: "user", Content: "Requête refusée : " + err.Error() + ". Corrige-la."})
+			continue
+		}
+
+		result, err := utils.ReadOnlyQuery(ctx, db, answer.SQL, utils.DefaultQueryLimits().WithMaxRows(req.MaxRows))
+		if errors.Is(err, utils.ErrQueryTimeout) {
+			return nil, &nl2sqlError{http.StatusGatewayTimeout, err}
+		}
+		var costErr *utils.QueryCostError
+		if errors.As(err, &costErr) {
+			lastErr = err
+			messages = append(messages, utils.ChatMessage{Role: "user", Content: "Requête refusée : " + err.Error() + ". Propose une requête moins coûteuse."})
+			continue
+		}
+		if err != nil {
+			lastErr = err
+			messages = append(messages, utils.ChatMessage{Role: "user", Content: "Erreur PostgreSQL : " + err.Error() + ". Corrige la requête."})
+			continue
+		}
+
+		return &NL2SQLResponse{
+			Question:    req.Question,
+			SQL:         answer.SQL,
+			Explanation: answer.Explanation,
+			QueryResult: *result,
+		}, nil
+	}
+
+	return nil, &nl2sqlError{http.StatusUnprocessableEntity, fmt.Errorf("Impossible de produire une requête valide : %v", lastErr)}
+}
+
+// validateNL2SQL vérifie la question et complète max_rows.
+func validateNL2SQL(req *models.NL2SQLRequest) error {
+	if req.Question == "" {
+		return fmt.Errorf("Le champ 'question' est requis")
+	}
+	if req.MaxRows < 0 {
+		return fmt.Errorf("max_rows doit être positif")
+	}
+	if req.MaxRows == 0 {
+		req.MaxRows = defaultNL2SQLMaxRows
+	}
+	return nil
+}
+
+// NL2SQLHandler traduit une question en SELECT avec le modèle de langage, à
+// partir du schéma de la base, vérifie la requête puis l'exécute.
+func NL2SQLHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	if userID, ok := middlewares.GetUserIDFromContext(r.Context()); !ok || userID == "" {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.NL2SQLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON invalide: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := validateNL2SQL(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := runNL2SQL(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), nl2sqlStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/middlewares"
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/RINOHeinrich1/postgres-vectorizer/vectorizer"
+)
+
+// POST /notify/install : installe le trigger pg_notify et démarre l'écoute
+func InstallNotifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.FormatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON invalide: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.SSLMode == "" {
+		req.SSLMode = "disable"
+	}
+	if req.TableName == "" || req.Template == "" {
+		http.Error(w, "table_name et template sont obligatoires", http.StatusBadRequest)
+		return
+	}
+	if _, err := template.New("line").Parse(req.Template); err != nil {
+		http.Error(w, "Erreur parsing template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sub, err := vectorizer.Notify.Install(r.Context(), userID, req)
+	if err != nil {
+		http.Error(w, "Erreur installation trigger: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Trigger installé sur %s", sub.Source),
+		"channel": sub.Channel,
+	})
+}
+
+// POST /notify/uninstall : arrête l'écoute et supprime le trigger
+func UninstallNotifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.StopSyncRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "JSON invalide: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DBName == "" || req.TableName == "" {
+		http.Error(w, "dbname et table_name sont obligatoires", http.StatusBadRequest)
+		return
+	}
+
+	source := fmt.Sprintf("%s/%s", req.DBName, req.TableName)
+	if err := vectorizer.Notify.Uninstall(r.Context(), userID, source); err != nil {
+		http.Error(w, "Erreur désinstallation trigger: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Trigger supprimé de %s", source),
+	})
+}
+
+// GET /notify/status : état des abonnements de l'utilisateur
+func NotifyStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
+	statuses, err := vectorizer.Notify.Status(userID)
+	if err != nil {
+		http.Error(w, "Erreur lecture état: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
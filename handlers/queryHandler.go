@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/middlewares"
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+)
+
+// QueryRequest est une question à router vers la recherche ou vers SQL. Les
+// options de recherche sont celles de /ask ; connection est requise pour le
+// chemin SQL.
+type QueryRequest struct {
+	SearchRequest
+
+	Connection *models.ConnParams `json:"connection,omitempty"`
+	Tables     []string           `json:"tables,omitempty"`   // optionnel, tables proposées au modèle
+	MaxRows    int                `json:"max_rows,omitempty"` // optionnel, défaut 1000
+
+	Route         string `json:"route,omitempty"`          // auto (défaut), search ou sql
+	LLMClassifier bool   `json:"llm_classifier,omitempty"` // classe la question avec le modèle
+}
+
+// QueryResponse indique le chemin suivi et porte le résultat correspondant.
+type QueryResponse struct {
+	utils.Route
+	Fallback string               `json:"fallback,omitempty"` // raison d'un repli sur la recherche
+	Search   []utils.SearchResult `json:"search,omitempty"`
+	SQL      *NL2SQLResponse      `json:"sql,omitempty"`
+}
+
+// QueryHandler choisit entre recherche sémantique et SQL pour répondre à une
+// question, puis exécute le chemin retenu. Si la génération SQL échoue, la
+// question est traitée par la recherche.
+func QueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Méthode non autorisée", http.StatusMethodNotAllowed)
+		return
+	}
+	userID, ok := middlewares.GetUserIDFromContext(r.Context())
+	if !ok || userID == "" {
+		http.Error(w, "Utilisateur non authentifié", http.StatusUnauthorized)
+		return
+	}
+
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Requête JSON invalide", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := req.SearchRequest.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.GroupBy != "" {
+		http.Error(w, "group_by n'est pas supporté par /query", http.StatusBadRequest)
+		return
+	}
+
+	var route utils.Route
+	switch req.Route {
+	case "", "auto":
+		route = utils.ClassifyQuestion(req.Query)
+		if req.LLMClassifier {
+			if llm, err := utils.GetLLM(); err != nil {
+				log.Printf("classifieur LLM indisponible : %v", err)
+			} else if llmRoute, err := utils.ClassifyQuestionLLM(r.Context(), llm, req.Query); err != nil {
+				log.Printf("classification LLM : %v", err)
+			} else {
+				route = llmRoute
+			}
+		}
+		if route.Route == utils.RouteSQL && req.Connection == nil {
+			route = utils.Route{Route: utils.RouteSearch, Reason: route.Reason + " ; pas de connexion fournie", Classifier: route.Classifier}
+		}
+	case utils.RouteSearch, utils.RouteSQL:
+		route = utils.Route{Route: req.Route, Reason: "chemin imposé par la requête", Classifier: "request"}
+	default:
+		http.Error(w, "route invalide (auto, search ou sql)", http.StatusBadRequest)
+		return
+	}
+
+	resp := QueryResponse{Route: route}
+	if route.Route == utils.RouteSQL {
+		if req.Connection == nil {
+			http.Error(w, "connection est obligatoire pour le chemin sql", http.StatusBadRequest)
+			return
+		}
+		nlReq := models.NL2SQLRequest{
+			ConnParams: *req.Connection,
+			Question:   req.Query,
+			Tables:     req.Tables,
+			MaxRows:    req.MaxRows,
+		}
+		if err := validateNL2SQL(&nlReq); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sqlResp, err := runNL2SQL(r.Context(), nlReq)
+		switch {
+		case err == nil:
+			resp.SQL = sqlResp
+			writeQueryResponse(w, resp)
+			return
+		case req.Route == utils.RouteSQL:
+			// Chemin imposé : pas de repli
+			http.Error(w, err.Error(), nl2sqlStatus(err))
+			return
+		default:
+			resp.Route.Route = utils.RouteSearch
+			resp.Fallback = err.Error()
+		}
+	}
+
+	results, _, err := runSearch(r.Context(), userID, &req.SearchRequest)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if results == nil {
+		results = []utils.SearchResult{}
+	}
+	resp.Search = results
+	writeQueryResponse(w, resp)
+}
+
+func writeQueryResponse(w http.ResponseWriter, resp QueryResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
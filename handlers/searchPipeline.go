@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+	"github.com/RINOHeinrich1/postgres-vectorizer/vectorizer"
+)
+
+type SearchRequest struct {
+	Query   string   `json:"query"`
+	TopK    int      `json:"top_k"`              // optionnel
+	Sources []string `json:"sources,omitempty"`  // optionnel, ex. "testdb/produits"
+	DataIDs []string `json:"data_ids,omitempty"` // optionnel
+	// Filtre sur les colonnes copiées dans le payload (optionnel)
+	Filter *utils.FilterExpr `json:"filter,omitempty"`
+
+	ScoreThreshold *float32 `json:"score_threshold,omitempty"` // optionnel
+	Offset         int      `json:"offset,omitempty"`          // optionnel, pagination
+	WithPayload    []string `json:"with_payload,omitempty"`    // optionnel, ex. ["text", "data_id"]
+	GroupBy        string   `json:"group_by,omitempty"`        // optionnel, ex. "data_id" ou "source"
+	GroupSize      int      `json:"group_size,omitempty"`      // optionnel, défaut 1
+	Mode           string   `json:"mode,omitempty"`            // dense (défaut), sparse ou hybrid
+
+	Rerank           bool `json:"rerank,omitempty"`            // optionnel, réordonne avec le reranker
+	RerankCandidates int  `json:"rerank_candidates,omitempty"` // optionnel, candidats à réordonner
+
+	MMR           bool     `json:"mmr,omitempty"`            // optionnel, diversifie les résultats
+	MMRLambda     *float64 `json:"mmr_lambda,omitempty"`     // optionnel, 1 = pertinence seule, 0 = diversité seule
+	MMRCandidates int      `json:"mmr_candidates,omitempty"` // optionnel, candidats parmi lesquels choisir
+
+	// Relit la ligne courante de chaque résultat dans PostgreSQL (optionnel)
+	Hydrate bool `json:"hydrate,omitempty"`
+}
+
+const (
+	// Nombre de candidats récupérés avant rerank ou MMR
+	defaultRerankCandidates = 50
+	maxRerankCandidates     = 200
+
+	defaultMaxTopK   = 100
+	defaultMaxOffset = 1000
+)
+
+// searchLimits retourne les plafonds de top_k et d'offset, réglables par
+// SEARCH_MAX_TOP_K et SEARCH_MAX_OFFSET.
+func searchLimits() (maxTopK, maxOffset int) {
+	maxTopK, maxOffset = defaultMaxTopK, defaultMaxOffset
+	if n, err := strconv.Atoi(os.Getenv("SEARCH_MAX_TOP_K")); err == nil && n > 0 {
+		maxTopK = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SEARCH_MAX_OFFSET")); err == nil && n >= 0 {
+		maxOffset = n
+	}
+	return maxTopK, maxOffset
+}
+
+// validate vérifie la requête et complète les valeurs par défaut. Les erreurs
+// retournées sont destinées au client (400).
+func (req *SearchRequest) validate() error {
+	if req.Query == "" {
+		return fmt.Errorf("Le champ 'query' est requis")
+	}
+	maxTopK, maxOffset := searchLimits()
+	if req.TopK < 0 || req.TopK > maxTopK {
+		return fmt.Errorf("top_k doit être compris entre 1 et %d", maxTopK)
+	}
+	if req.TopK == 0 {
+		req.TopK = 5 // Valeur par défaut
+	}
+	if req.Offset < 0 || req.Offset > maxOffset {
+		return fmt.Errorf("offset doit être compris entre 0 et %d", maxOffset)
+	}
+	if req.Filter != nil {
+		if _, _, err := req.Filter.ToQdrant(); err != nil {
+			return fmt.Errorf("Filtre invalide : %w", err)
+		}
+	}
+	if req.GroupSize < 0 {
+		return fmt.Errorf("group_size doit être positif")
+	}
+	if err := utils.ValidateSearchMode(req.Mode); err != nil {
+		return err
+	}
+	if req.GroupBy != "" {
+		if req.Mode == utils.SearchHybrid {
+			return fmt.Errorf("group_by n'est pas supporté en mode hybrid")
+		}
+		if _, err := utils.GroupByField(req.GroupBy); err != nil {
+			return fmt.Errorf("group_by invalide : %w", err)
+		}
+		if req.Offset > 0 {
+			return fmt.Errorf("offset n'est pas supporté avec group_by")
+		}
+		if req.Rerank || req.MMR {
+			return fmt.Errorf("rerank et mmr ne sont pas supportés avec group_by")
+		}
+	}
+	if req.Rerank && req.MMR {
+		return fmt.Errorf("rerank et mmr ne peuvent pas être combinés")
+	}
+	if req.RerankCandidates < 0 || req.RerankCandidates > maxRerankCandidates ||
+		req.MMRCandidates < 0 || req.MMRCandidates > maxRerankCandidates {
+		return fmt.Errorf("rerank_candidates et mmr_candidates doivent être compris entre 0 et %d", maxRerankCandidates)
+	}
+	if req.RerankCandidates == 0 {
+		req.RerankCandidates = defaultRerankCandidates
+	}
+	if req.MMRCandidates == 0 {
+		req.MMRCandidates = defaultRerankCandidates
+	}
+	if req.MMRLambda != nil && (*req.MMRLambda < 0 || *req.MMRLambda > 1) {
+		return fmt.Errorf("mmr_lambda doit être compris entre 0 et 1")
+	}
+
+	// La réhydratation s'appuie sur source et data_id
+	if req.Hydrate && len(req.WithPayload) > 0 {
+		for _, field := range []string{"source", "data_id"} {
+			if !slices.Contains(req.WithPayload, field) {
+				req.WithPayload = append(req.WithPayload, field)
+			}
+		}
+	}
+	return nil
+}
+
+// runSearch exécute la chaîne embedding + recherche (+ rerank, MMR,
+// réhydratation) d'une requête validée. Seul l'un des deux résultats est
+// renseigné : les groupes si group_by est demandé, la liste sinon.
+func runSearch(ctx context.Context, userID string, req *SearchRequest) ([]utils.SearchResult, []utils.SearchGroup, error) {
+	// Générer l'embedding
+	embedder, err := utils.GetEmbedder()
+	if err != nil {
+		return nil, nil, fmt.Errorf("Erreur configuration embedder : %w", err)
+	}
+	vector, err := embedder.Embed(req.Query)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Erreur génération vecteur : %w", err)
+	}
+
+	opts := utils.SearchOptions{
+		Vector:         vector,
+		TopK:           req.TopK,
+		OwnerID:        userID,
+		Sources:        req.Sources,
+		DataIDs:        req.DataIDs,
+		Filter:         req.Filter,
+		ScoreThreshold: req.ScoreThreshold,
+		Offset:         req.Offset,
+		WithPayload:    req.WithPayload,
+		GroupBy:        req.GroupBy,
+		GroupSize:      req.GroupSize,
+		Mode:           req.Mode,
+		QueryText:      req.Query,
+	}
+
+	// Recherche groupée : un groupe par valeur de group_by
+	if req.GroupBy != "" {
+		groups, err := utils.SearchQdrantGroups(opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Erreur recherche Qdrant : %w", err)
+		}
+		if req.Hydrate {
+			var hits []*utils.SearchResult
+			for g := range groups {
+				for h := range groups[g].Hits {
+					hits = append(hits, &groups[g].Hits[h])
+				}
+			}
+			if err := vectorizer.HydrateResults(ctx, userID, hits); err != nil {
+				return nil, nil, fmt.Errorf("Erreur réhydratation : %w", err)
+			}
+		}
+		return nil, groups, nil
+	}
+
+	// Recherche dans Qdrant, avec réordonnancement éventuel des candidats
+	var results []utils.SearchResult
+	switch {
+	case req.MMR:
+		lambda := utils.DefaultMMRLambda
+		if req.MMRLambda != nil {
+			lambda = *req.MMRLambda
+		}
+		results, err = utils.SearchQdrantMMR(opts, lambda, req.MMRCandidates)
+	case req.Rerank:
+		reranker, rerr := utils.GetReranker()
+		if rerr != nil {
+			return nil, nil, fmt.Errorf("Erreur configuration reranker : %w", rerr)
+		}
+		results, err = utils.SearchQdrantReranked(opts, reranker, req.Query, req.RerankCandidates)
+	default:
+		results, err = utils.SearchQdrant(opts)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("Erreur recherche Qdrant : %w", err)
+	}
+
+	if req.Hydrate {
+		hits := make([]*utils.SearchResult, len(results))
+		for i := range results {
+			hits[i] = &results[i]
+		}
+		if err := vectorizer.HydrateResults(ctx, userID, hits); err != nil {
+			return nil, nil, fmt.Errorf("Erreur réhydratation : %w", err)
+		}
+	}
+	return results, nil, nil
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+)
+
+// writeSQLSafetyError répond 403 avec la règle violée en JSON :
+// {"error": "...", "rule": "...", "token": "...", "position": n}.
+func writeSQLSafetyError(w http.ResponseWriter, err error) {
+	var safety *utils.SQLSafetyError
+	if !errors.As(err, &safety) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+		*utils.SQLSafetyError
+	}{Error: safety.Error(), SQLSafetyError: safety})
+}
+
+// writeQueryError répond 403 avec le plan si le coût estimé dépasse le
+// plafond, 504 si la requête a dépassé son délai, 500 sinon.
+func writeQueryError(w http.ResponseWriter, err error) {
+	var costErr *utils.QueryCostError
+	if errors.As(err, &costErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(struct {
+			Error string `json:"error"`
+			*utils.QueryPlan
+		}{Error: costErr.Error(), QueryPlan: costErr.QueryPlan})
+		return
+	}
+	if errors.Is(err, utils.ErrQueryTimeout) {
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/RINOHeinrich1/postgres-vectorizer/handlers"
 	"github.com/RINOHeinrich1/postgres-vectorizer/middlewares"
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+	"github.com/RINOHeinrich1/postgres-vectorizer/vectorizer"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/qdrant/go-client/qdrant"
@@ -22,6 +24,14 @@ func init() {
 func main() {
 	_ = godotenv.Load()
 
+	// --- Embedder ---
+	embedder, err := utils.NewEmbedderFromEnv()
+	if err != nil {
+		log.Fatalf("Erreur configuration embedder : %v", err)
+	}
+	utils.SetEmbedder(embedder)
+	fmt.Printf("🧠 Embedder : modèle %q, dimension %d\n", embedder.ModelName(), embedder.Dimension())
+
 	// --- Qdrant ---
 	host := os.Getenv("QDRANT_HOST")
 	portStr := os.Getenv("QDRANT_PORT")
@@ -55,6 +65,18 @@ func main() {
 	}
 	if exists {
 		fmt.Println("✅ La collection existe déjà.")
+
+		// Le vecteur creux BM25 n'est utilisé que si la collection le porte
+		info, err := client.GetCollectionInfo(ctx, collection)
+		if err != nil {
+			log.Fatalf("Erreur lecture configuration collection : %v", err)
+		}
+		sparse := info.GetConfig().GetParams().GetSparseVectorsConfig().GetMap()
+		if _, ok := sparse[utils.DefaultSparseVectorName]; ok {
+			utils.SetSparseVectorName(utils.DefaultSparseVectorName)
+		} else {
+			fmt.Printf("⚠️ Pas de vecteur creux %q : recherche dense uniquement.\n", utils.DefaultSparseVectorName)
+		}
 	} else {
 		fmt.Println("ℹ️ La collection n'existe pas. Création en cours...")
 
@@ -63,16 +85,23 @@ func main() {
 			VectorsConfig: &qdrant.VectorsConfig{
 				Config: &qdrant.VectorsConfig_Params{
 					Params: &qdrant.VectorParams{
-						Size:     384,
+						Size:     uint64(embedder.Dimension()),
 						Distance: qdrant.Distance_Cosine,
 					},
 				},
 			},
+			// Vecteur creux BM25 pour la recherche lexicale et hybride
+			SparseVectorsConfig: &qdrant.SparseVectorConfig{
+				Map: map[string]*qdrant.SparseVectorParams{
+					utils.DefaultSparseVectorName: {Modifier: qdrant.Modifier_Idf.Enum()},
+				},
+			},
 		})
 
 		if err != nil {
 			log.Fatalf("❌ Erreur lors de la création de la collection : %v", err)
 		}
+		utils.SetSparseVectorName(utils.DefaultSparseVectorName)
 		// Indexer le champ owner_id
 		_, err = client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
 			CollectionName: collection,
@@ -104,6 +133,14 @@ func main() {
 		fmt.Println("✅ Collection créée avec succès.")
 	}
 
+	// --- Flux CDC et triggers LISTEN/NOTIFY enregistrés ---
+	if err := vectorizer.CDC.Restore(); err != nil {
+		log.Fatalf("Erreur reprise des flux CDC : %v", err)
+	}
+	if err := vectorizer.Notify.Restore(); err != nil {
+		log.Fatalf("Erreur reprise des écoutes NOTIFY : %v", err)
+	}
+
 	// --- Serveur HTTP ---
 	bindAddr := os.Getenv("BIND_ADDR")
 	if bindAddr == "" {
@@ -124,8 +161,21 @@ func main() {
 	mux.HandleFunc("/staticvectorizer", handlers.StaticVectorizerHandler)
 	mux.HandleFunc("/deletevectorizeddata", handlers.DeleteVectorizedDataHandler)
 	mux.HandleFunc("/ask", handlers.AskHandler)
+	mux.HandleFunc("/answer", handlers.AnswerHandler)
+	mux.HandleFunc("/answer/stream", handlers.AnswerStreamHandler)
 	mux.HandleFunc("/execute", handlers.ExecuteSQLHandler)
+	mux.HandleFunc("/nl2sql", handlers.NL2SQLHandler)
+	mux.HandleFunc("/query", handlers.QueryHandler)
 	mux.HandleFunc("/insert-single", handlers.InsertSingleDocumentHandler)
+	mux.HandleFunc("/jobs", handlers.ListJobsHandler)
+	mux.HandleFunc("/jobs/{id}", handlers.GetJobHandler)
+	mux.HandleFunc("/jobs/{id}/cancel", handlers.CancelJobHandler)
+	mux.HandleFunc("/cdc/start", handlers.StartCDCHandler)
+	mux.HandleFunc("/cdc/stop", handlers.StopCDCHandler)
+	mux.HandleFunc("/cdc/status", handlers.CDCStatusHandler)
+	mux.HandleFunc("/notify/install", handlers.InstallNotifyHandler)
+	mux.HandleFunc("/notify/uninstall", handlers.UninstallNotifyHandler)
+	mux.HandleFunc("/notify/status", handlers.NotifyStatusHandler)
 	protectedHandler := middlewares.CORSMiddleware(middlewares.JWTMiddleware(mux))
 
 	fmt.Printf("🚀 Serveur lancé sur http://%s\n", address)
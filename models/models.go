@@ -25,7 +25,34 @@ type FormatRequest struct {
 	ConnParams
 	TableName string `json:"table_name"`
 	Template  string `json:"template"`
-	PageSize  int    `json:"page_size,omitempty"` // optionnel, défaut 100
+	PageSize  int    `json:"page_size,omitempty"`  // optionnel, défaut 100
+	BatchSize int    `json:"batch_size,omitempty"` // optionnel, défaut page_size
+	Mode      string `json:"mode,omitempty"`       // "full" (défaut), "resume" ou "sync"
+	// Colonne de suivi des modifications (ex. updated_at), requise en mode sync
+	WatermarkColumn string `json:"watermark_column,omitempty"`
+	// Colonnes copiées dans le payload Qdrant pour filtrer /ask (optionnel)
+	PayloadColumns []string `json:"payload_columns,omitempty"`
+}
+
+// Requête de démarrage d'un flux de réplication logique (CDC)
+type CDCRequest struct {
+	FormatRequest
+	SlotName        string `json:"slot_name,omitempty"`        // optionnel, dérivé de la source
+	PublicationName string `json:"publication_name,omitempty"` // optionnel, défaut slot_name
+}
+
+// Requête d'arrêt d'un flux de synchronisation
+type StopSyncRequest struct {
+	DBName    string `json:"dbname"`
+	TableName string `json:"table_name"`
+	Drop      bool   `json:"drop,omitempty"` // supprime aussi slot / trigger côté PostgreSQL
+}
+
+// Rapport d'un lot envoyé à l'embedder et à Qdrant
+type BatchReport struct {
+	Batch int    `json:"batch"`
+	Rows  int    `json:"rows"`
+	Error string `json:"error,omitempty"`
 }
 
 type QdrantPoint struct {
@@ -37,3 +64,11 @@ type QdrantPoint struct {
 type QdrantUpsertRequest struct {
 	Points []QdrantPoint `json:"points"`
 }
+
+// Requête de traduction d'une question en SQL (/nl2sql)
+type NL2SQLRequest struct {
+	ConnParams
+	Question string   `json:"question"`
+	Tables   []string `json:"tables,omitempty"`   // optionnel, restreint le schéma fourni au modèle
+	MaxRows  int      `json:"max_rows,omitempty"` // optionnel, défaut 1000
+}
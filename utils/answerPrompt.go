@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxContextChars borne la taille des extraits injectés dans le prompt.
+const DefaultMaxContextChars = 12000
+
+const answerSystemPrompt = `Tu réponds aux questions uniquement à partir des extraits numérotés fournis.
+Cite chaque information utilisée avec le numéro de son extrait entre crochets, par exemple [1] ou [2][3].
+Si les extraits ne permettent pas de répondre, dis-le clairement sans inventer.
+Réponds dans la langue de la question.`
+
+// Citation est un extrait fourni au modèle, repéré par son numéro dans le prompt.
+type Citation struct {
+	Index  int                    `json:"index"`
+	Source string                 `json:"source,omitempty"`
+	DataID string                 `json:"data_id,omitempty"`
+	Score  float32                `json:"score"`
+	Text   string                 `json:"text"`
+	Row    map[string]interface{} `json:"row,omitempty"`
+	Cited  bool                   `json:"cited"` // le numéro apparaît dans la réponse
+}
+
+// citationText retourne le texte d'un résultat : le texte vectorisé, ou à
+// défaut la ligne réhydratée en JSON.
+func citationText(hit SearchResult) string {
+	if text, _ := hit.Payload["text"].(string); text != "" {
+		return text
+	}
+	if hit.Row != nil {
+		if b, err := json.Marshal(hit.Row); err == nil {
+			return string(b)
+		}
+	}
+	return ""
+}
+
+// BuildAnswerPrompt construit la conversation envoyée au modèle : consigne,
+// extraits numérotés avec leur source et data_id, puis la question. Les
+// extraits sont ajoutés dans l'ordre jusqu'à maxChars caractères.
+func BuildAnswerPrompt(question string, hits []SearchResult, maxChars int) ([]ChatMessage, []Citation) {
+	if maxChars <= 0 {
+		maxChars = DefaultMaxContextChars
+	}
+
+	var context strings.Builder
+	citations := []Citation{}
+	for _, hit := range hits {
+		text := citationText(hit)
+		if text == "" {
+			continue
+		}
+		c := Citation{Index: len(citations) + 1, Score: hit.Score, Text: text, Row: hit.Row}
+		c.Source, _ = hit.Payload["source"].(string)
+		c.DataID, _ = hit.Payload["data_id"].(string)
+
+		block := fmt.Sprintf("[%d] (source : %s, data_id : %s)\n%s\n\n", c.Index, c.Source, c.DataID, text)
+		if context.Len()+len(block) > maxChars && len(citations) > 0 {
+			break
+		}
+		context.WriteString(block)
+		citations = append(citations, c)
+	}
+
+	messages := []ChatMessage{
+		{Role: "system", Content: answerSystemPrompt},
+		{Role: "user", Content: "Extraits :\n\n" + context.String() + "Question : " + question},
+	}
+	return messages, citations
+}
+
+var citationRe = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// MarkCitations repère les numéros d'extraits cités dans la réponse, sous la
+// forme [1], [2][3] ou [2, 3].
+func MarkCitations(answer string, citations []Citation) {
+	for _, m := range citationRe.FindAllStringSubmatch(answer, -1) {
+		for _, num := range strings.Split(m[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(num))
+			if err == nil && n >= 1 && n <= len(citations) {
+				citations[n-1].Cited = true
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildAnswerPrompt(t *testing.T) {
+	hits := []SearchResult{
+		{Score: 0.9, Payload: map[string]interface{}{"text": "Nancy Edwards est née en 1958.", "source": "db.Employee", "data_id": "2"}},
+		{Score: 0.8, Payload: map[string]interface{}{"source": "db.Employee", "data_id": "3"}}, // sans texte : ignoré
+		{Score: 0.7, Payload: map[string]interface{}{"source": "db.Employee", "data_id": "4"}, Row: map[string]interface{}{"FirstName": "Jane"}},
+	}
+
+	messages, citations := BuildAnswerPrompt("Quand est née Nancy ?", hits, 0)
+	if len(messages) != 2 || messages[0].Role != "system" || messages[1].Role != "user" {
+		t.Fatalf("messages inattendus : %+v", messages)
+	}
+	if len(citations) != 2 {
+		t.Fatalf("2 extraits attendus, reçu %+v", citations)
+	}
+	if citations[0].Index != 1 || citations[0].DataID != "2" || citations[1].Index != 2 || citations[1].DataID != "4" {
+		t.Errorf("numérotation inattendue : %+v", citations)
+	}
+	if citations[1].Text != `{"FirstName":"Jane"}` {
+		t.Errorf("la ligne réhydratée doit servir de texte, reçu %q", citations[1].Text)
+	}
+	prompt := messages[1].Content
+	if !strings.Contains(prompt, "[1] (source : db.Employee, data_id : 2)") || !strings.HasSuffix(prompt, "Question : Quand est née Nancy ?") {
+		t.Errorf("prompt inattendu :\n%s", prompt)
+	}
+}
+
+func TestBuildAnswerPromptMaxChars(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	hits := []SearchResult{
+		{Payload: map[string]interface{}{"text": long}},
+		{Payload: map[string]interface{}{"text": long}},
+	}
+	// Le premier extrait est toujours gardé, le second dépasse la limite
+	_, citations := BuildAnswerPrompt("q", hits, 50)
+	if len(citations) != 1 {
+		t.Errorf("1 extrait attendu, reçu %d", len(citations))
+	}
+}
+
+func TestMarkCitations(t *testing.T) {
+	tests := []struct {
+		answer string
+		cited  []bool
+	}{
+		{"Elle est née en 1958 [1].", []bool{true, false, false, false}},
+		{"Voir [2][3].", []bool{false, true, true, false}},
+		{"Voir [1, 4] et [3 ,2].", []bool{true, true, true, true}},
+		{"Hors limites [0] [5] [12], pas de citation [a].", []bool{false, false, false, false}},
+		{"Aucune source.", []bool{false, false, false, false}},
+	}
+	for _, tt := range tests {
+		citations := make([]Citation, 4)
+		MarkCitations(tt.answer, citations)
+		for i, c := range citations {
+			if c.Cited != tt.cited[i] {
+				t.Errorf("%q : extrait %d cité = %v, attendu %v", tt.answer, i+1, c.Cited, tt.cited[i])
+			}
+		}
+	}
+}
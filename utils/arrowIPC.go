@@ -0,0 +1,487 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Écriture du format Apache Arrow IPC « stream » : un message Schema, des
+// messages RecordBatch, puis le marqueur de fin. Les métadonnées sont des
+// flatbuffers (Schema.fbs / Message.fbs) encodés à la main, pour les seuls
+// types utilisés ici.
+
+const arrowBatchSize = 1024
+
+// Identifiants des unions et énumérations de Schema.fbs / Message.fbs.
+const (
+	arrowMetadataV5 = 4
+
+	arrowHeaderSchema      = 1
+	arrowHeaderRecordBatch = 3
+
+	arrowTypeInt           = 2
+	arrowTypeFloatingPoint = 3
+	arrowTypeBinary        = 4
+	arrowTypeUtf8          = 5
+	arrowTypeBool          = 6
+	arrowTypeDate          = 8
+	arrowTypeTimestamp     = 10
+
+	arrowPrecisionSingle = 1
+	arrowPrecisionDouble = 2
+	arrowDateUnitDay     = 0
+	arrowTimeUnitMicro   = 2
+)
+
+// arrowColumn accumule les buffers d'une colonne pour le lot en cours.
+type arrowColumn struct {
+	typeID   byte
+	width    int // octets par valeur pour les types à largeur fixe
+	validity []byte
+	values   []byte
+	offsets  []byte // int32, types à longueur variable
+	nulls    int
+}
+
+// newArrowColumn choisit le type Arrow d'une colonne PostgreSQL ; les types
+// sans équivalent direct (numeric, uuid, json...) passent en texte.
+func newArrowColumn(typ string) *arrowColumn {
+	switch typ {
+	case "INT2":
+		return &arrowColumn{typeID: arrowTypeInt, width: 2}
+	case "INT4":
+		return &arrowColumn{typeID: arrowTypeInt, width: 4}
+	case "INT8":
+		return &arrowColumn{typeID: arrowTypeInt, width: 8}
+	case "FLOAT4":
+		return &arrowColumn{typeID: arrowTypeFloatingPoint, width: 4}
+	case "FLOAT8":
+		return &arrowColumn{typeID: arrowTypeFloatingPoint, width: 8}
+	case "BOOL":
+		return &arrowColumn{typeID: arrowTypeBool}
+	case "DATE":
+		return &arrowColumn{typeID: arrowTypeDate, width: 4}
+	case "TIMESTAMP", "TIMESTAMPTZ":
+		return &arrowColumn{typeID: arrowTypeTimestamp, width: 8}
+	case "BYTEA":
+		return &arrowColumn{typeID: arrowTypeBinary}
+	}
+	return &arrowColumn{typeID: arrowTypeUtf8}
+}
+
+func (c *arrowColumn) variable() bool {
+	return c.typeID == arrowTypeUtf8 || c.typeID == arrowTypeBinary
+}
+
+// fieldType retourne le tag et la table de l'union Type du schéma.
+func (c *arrowColumn) fieldType(pgType string) (byte, fbTable) {
+	switch c.typeID {
+	case arrowTypeInt:
+		return c.typeID, fbTable{fbInt32(int32(c.width * 8)), fbBool(true)}
+	case arrowTypeFloatingPoint:
+		precision := int16(arrowPrecisionDouble)
+		if c.width == 4 {
+			precision = arrowPrecisionSingle
+		}
+		return c.typeID, fbTable{fbInt16(precision)}
+	case arrowTypeDate:
+		return c.typeID, fbTable{fbInt16(arrowDateUnitDay)}
+	case arrowTypeTimestamp:
+		t := fbTable{fbInt16(arrowTimeUnitMicro)}
+		if pgType == "TIMESTAMPTZ" {
+			t = append(t, fbRef(fbString("UTC")))
+		}
+		return c.typeID, t
+	}
+	return c.typeID, fbTable{}
+}
+
+// reset vide les buffers ; les offsets commencent à 0.
+func (c *arrowColumn) reset() {
+	c.validity, c.values, c.nulls = c.validity[:0], c.values[:0], 0
+	if c.variable() {
+		c.offsets = binary.LittleEndian.AppendUint32(c.offsets[:0], 0)
+	}
+}
+
+func (c *arrowColumn) setValid(row int, valid bool) {
+	if row%8 == 0 {
+		c.validity = append(c.validity, 0)
+	}
+	if valid {
+		c.validity[row/8] |= 1 << (row % 8)
+	} else {
+		c.nulls++
+	}
+}
+
+// appendValue ajoute la valeur de la ligne row (numérotée dans le lot).
+func (c *arrowColumn) appendValue(row int, v interface{}) error {
+	c.setValid(row, v != nil)
+
+	switch c.typeID {
+	case arrowTypeUtf8, arrowTypeBinary:
+		if v != nil {
+			c.values = append(c.values, formatCSVValue(v, "")...)
+		}
+		c.offsets = binary.LittleEndian.AppendUint32(c.offsets, uint32(len(c.values)))
+		return nil
+
+	case arrowTypeBool:
+		if row%8 == 0 {
+			c.values = append(c.values, 0)
+		}
+		if b, _ := v.(bool); b {
+			c.values[row/8] |= 1 << (row % 8)
+		}
+		return nil
+	}
+
+	var bits uint64
+	if v != nil {
+		var err error
+		if bits, err = c.fixedBits(v); err != nil {
+			return err
+		}
+	}
+	switch c.width {
+	case 2:
+		c.values = binary.LittleEndian.AppendUint16(c.values, uint16(bits))
+	case 4:
+		c.values = binary.LittleEndian.AppendUint32(c.values, uint32(bits))
+	default:
+		c.values = binary.LittleEndian.AppendUint64(c.values, bits)
+	}
+	return nil
+}
+
+// fixedBits convertit une valeur vers sa représentation binaire Arrow.
+func (c *arrowColumn) fixedBits(v interface{}) (uint64, error) {
+	switch c.typeID {
+	case arrowTypeInt:
+		switch n := v.(type) {
+		case int64:
+			return uint64(n), nil
+		case string:
+			i, err := strconv.ParseInt(n, 10, 64)
+			return uint64(i), err
+		}
+	case arrowTypeFloatingPoint:
+		var f float64
+		switch n := v.(type) {
+		case float64:
+			f = n
+		case string:
+			var err error
+			if f, err = strconv.ParseFloat(n, 64); err != nil {
+				return 0, err
+			}
+		default:
+			return 0, fmt.Errorf("arrow : valeur inattendue %T pour un flottant", v)
+		}
+		if c.width == 4 {
+			return uint64(math.Float32bits(float32(f))), nil
+		}
+		return math.Float64bits(f), nil
+	case arrowTypeDate:
+		if t, ok := v.(time.Time); ok {
+			days := t.Unix() / 86400
+			if t.Unix()%86400 < 0 {
+				days--
+			}
+			return uint64(days), nil
+		}
+	case arrowTypeTimestamp:
+		if t, ok := v.(time.Time); ok {
+			return uint64(t.UnixMicro()), nil
+		}
+	}
+	return 0, fmt.Errorf("arrow : valeur inattendue %T", v)
+}
+
+// buffers retourne les buffers de la colonne dans l'ordre du format.
+func (c *arrowColumn) buffers() [][]byte {
+	if c.variable() {
+		return [][]byte{c.validity, c.offsets, c.values}
+	}
+	return [][]byte{c.validity, c.values}
+}
+
+// arrowResultWriter écrit le résultat en lots de arrowBatchSize lignes. Le
+// résumé (nombre de lignes, troncature) est transmis par les trailers HTTP.
+type arrowResultWriter struct {
+	w       io.Writer
+	columns []*arrowColumn
+	rows    int // lignes du lot en cours
+}
+
+func newArrowResultWriter(w io.Writer) *arrowResultWriter {
+	return &arrowResultWriter{w: w}
+}
+
+func (a *arrowResultWriter) WriteColumns(columns []ColumnMeta) error {
+	fields := make(fbTableVector, len(columns))
+	a.columns = make([]*arrowColumn, len(columns))
+	for i, col := range columns {
+		c := newArrowColumn(col.Type)
+		c.reset()
+		a.columns[i] = c
+
+		// Le type PostgreSQL d'origine voyage dans les métadonnées du champ
+		metadata := fbTableVector{
+			{fbRef(fbString("pg_type")), fbRef(fbString(col.Type))},
+			{fbRef(fbString("pg_oid")), fbRef(fbString(strconv.FormatUint(uint64(col.OID), 10)))},
+		}
+		typeID, typeTable := c.fieldType(col.Type)
+		fields[i] = fbTable{
+			fbRef(fbString(col.Name)),
+			fbBool(true), // nullable
+			fbUint8(typeID),
+			fbRef(typeTable),
+			{},                     // dictionary
+			fbRef(fbTableVector{}), // children
+			fbRef(metadata),
+		}
+	}
+	schema := fbTable{fbInt16(0), fbRef(fields)} // little-endian
+	return a.writeMessage(arrowHeaderSchema, schema, nil)
+}
+
+func (a *arrowResultWriter) WriteRow(values []interface{}) error {
+	for i, v := range values {
+		if err := a.columns[i].appendValue(a.rows, v); err != nil {
+			return fmt.Errorf("colonne %d : %w", i+1, err)
+		}
+	}
+	a.rows++
+	if a.rows == arrowBatchSize {
+		return a.flush()
+	}
+	return nil
+}
+
+// Close envoie le dernier lot et le marqueur de fin de flux.
+func (a *arrowResultWriter) Close(QuerySummary, error) error {
+	if a.columns == nil {
+		return nil
+	}
+	if a.rows > 0 {
+		if err := a.flush(); err != nil {
+			return err
+		}
+	}
+	_, err := a.w.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	return err
+}
+
+// flush écrit le lot en cours dans un message RecordBatch.
+func (a *arrowResultWriter) flush() error {
+	var body, nodes, buffers []byte
+	for _, c := range a.columns {
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(a.rows))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(c.nulls))
+		for _, buf := range c.buffers() {
+			buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(body)))
+			buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(buf)))
+			body = append(body, buf...)
+			body = append(body, make([]byte, pad8(len(body)))...)
+		}
+		c.reset()
+	}
+
+	batch := fbTable{
+		fbInt64(int64(a.rows)),
+		fbRef(fbStructVector{align: 8, count: len(a.columns), data: nodes}),
+		fbRef(fbStructVector{align: 8, count: len(buffers) / 16, data: buffers}),
+	}
+	a.rows = 0
+	return a.writeMessage(arrowHeaderRecordBatch, batch, body)
+}
+
+// writeMessage écrit un message encapsulé : marqueur de continuation, taille
+// des métadonnées, flatbuffer Message aligné sur 8 octets, puis le corps.
+func (a *arrowResultWriter) writeMessage(headerType byte, header fbTable, body []byte) error {
+	message := fbTable{
+		fbInt16(arrowMetadataV5),
+		fbUint8(headerType),
+		fbRef(header),
+		fbInt64(int64(len(body))),
+	}
+	meta := finishFlatbuffer(message)
+	meta = append(meta, make([]byte, pad8(len(meta)))...)
+
+	prefix := make([]byte, 8)
+	binary.LittleEndian.PutUint32(prefix, 0xffffffff)
+	binary.LittleEndian.PutUint32(prefix[4:], uint32(len(meta)))
+	for _, part := range [][]byte{prefix, meta, body} {
+		if _, err := a.w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pad8(n int) int {
+	return (8 - n%8) % 8
+}
+
+// --- Encodage flatbuffers minimal ---
+//
+// Contrairement aux builders officiels, le tampon est écrit de l'avant vers
+// l'arrière : chaque table est précédée de sa vtable (soffset positif) et
+// suivie des objets qu'elle référence (uoffset positif).
+
+// fbField est un champ de table : une valeur scalaire en ligne, une référence
+// vers un autre objet, ou rien (champ absent).
+type fbField struct {
+	scalar []byte
+	ref    fbObject
+}
+
+func fbBool(v bool) fbField {
+	if v {
+		return fbField{scalar: []byte{1}}
+	}
+	return fbField{scalar: []byte{0}}
+}
+
+func fbUint8(v byte) fbField { return fbField{scalar: []byte{v}} }
+
+func fbInt16(v int16) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint16(nil, uint16(v))}
+}
+
+func fbInt32(v int32) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint32(nil, uint32(v))}
+}
+
+func fbInt64(v int64) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint64(nil, uint64(v))}
+}
+
+func fbRef(o fbObject) fbField { return fbField{ref: o} }
+
+func (f fbField) size() int {
+	if f.ref != nil {
+		return 4
+	}
+	return len(f.scalar)
+}
+
+// fbObject est un objet adressable ; writeTo retourne sa position.
+type fbObject interface {
+	writeTo(b *fbBuilder) int
+}
+
+type fbBuilder struct {
+	buf []byte
+}
+
+func (b *fbBuilder) align(n int) {
+	for len(b.buf)%n != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+func (b *fbBuilder) putOffset(at, target int) {
+	binary.LittleEndian.PutUint32(b.buf[at:], uint32(target-at))
+}
+
+// finishFlatbuffer encode root et retourne le tampon complet.
+func finishFlatbuffer(root fbTable) []byte {
+	b := &fbBuilder{buf: make([]byte, 4)}
+	b.putOffset(0, root.writeTo(b))
+	return b.buf
+}
+
+// fbTable liste les champs par identifiant (ordre du schéma .fbs).
+type fbTable []fbField
+
+func (t fbTable) writeTo(b *fbBuilder) int {
+	// Disposition en ligne : soffset puis chaque champ aligné sur sa taille
+	offsets := make([]int, len(t))
+	size, align := 4, 4
+	for i, f := range t {
+		n := f.size()
+		if n == 0 {
+			continue
+		}
+		size = (size + n - 1) / n * n
+		offsets[i] = size
+		size += n
+		if n > align {
+			align = n
+		}
+	}
+
+	b.align(2)
+	vtable := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(4+2*len(t)))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(size))
+	for _, off := range offsets {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(off))
+	}
+
+	b.align(align)
+	start := len(b.buf)
+	b.buf = append(b.buf, make([]byte, size)...)
+	binary.LittleEndian.PutUint32(b.buf[start:], uint32(int32(start-vtable)))
+	for i, f := range t {
+		if f.scalar != nil {
+			copy(b.buf[start+offsets[i]:], f.scalar)
+		}
+	}
+	for i, f := range t {
+		if f.ref != nil {
+			at := start + offsets[i]
+			b.putOffset(at, f.ref.writeTo(b))
+		}
+	}
+	return start
+}
+
+type fbString string
+
+func (s fbString) writeTo(b *fbBuilder) int {
+	b.align(4)
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return start
+}
+
+type fbTableVector []fbTable
+
+func (v fbTableVector) writeTo(b *fbBuilder) int {
+	b.align(4)
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(v)))
+	b.buf = append(b.buf, make([]byte, 4*len(v))...)
+	for i, t := range v {
+		b.putOffset(start+4+4*i, t.writeTo(b))
+	}
+	return start
+}
+
+// fbStructVector est un vecteur de structs déjà encodées, dont les éléments
+// doivent être alignés sur align octets.
+type fbStructVector struct {
+	align int
+	count int
+	data  []byte
+}
+
+func (v fbStructVector) writeTo(b *fbBuilder) int {
+	for (len(b.buf)+4)%v.align != 0 {
+		b.buf = append(b.buf, 0)
+	}
+	start := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(v.count))
+	b.buf = append(b.buf, v.data...)
+	return start
+}
@@ -0,0 +1,430 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// Lecteur Arrow IPC « stream » écrit d'après la spécification (Schema.fbs,
+// Message.fbs), indépendamment du builder de arrowIPC.go : les flatbuffers
+// sont lus avec les règles génériques (vtable, uoffset) et l'alignement des
+// scalaires 64 bits et des vecteurs de structs est vérifié.
+
+type fbReadTable struct {
+	t   *testing.T
+	buf []byte
+	pos int
+}
+
+func (r fbReadTable) u32(p int) int { return int(binary.LittleEndian.Uint32(r.buf[p:])) }
+func (r fbReadTable) u16(p int) int { return int(binary.LittleEndian.Uint16(r.buf[p:])) }
+
+// field retourne la position absolue du champ id, ou 0 s'il est absent.
+func (r fbReadTable) field(id int) int {
+	vtable := r.pos - int(int32(binary.LittleEndian.Uint32(r.buf[r.pos:])))
+	if 4+2*id >= r.u16(vtable) {
+		return 0
+	}
+	if off := r.u16(vtable + 4 + 2*id); off != 0 {
+		return r.pos + off
+	}
+	return 0
+}
+
+func (r fbReadTable) table(id int) fbReadTable {
+	p := r.field(id)
+	if p == 0 {
+		r.t.Fatalf("table %d absente", id)
+	}
+	return fbReadTable{r.t, r.buf, p + r.u32(p)}
+}
+
+// vector retourne la position du premier élément et le nombre d'éléments.
+func (r fbReadTable) vector(id int) (int, int) {
+	p := r.field(id)
+	if p == 0 {
+		return 0, 0
+	}
+	v := p + r.u32(p)
+	return v + 4, r.u32(v)
+}
+
+func (r fbReadTable) tables(id int) []fbReadTable {
+	start, n := r.vector(id)
+	out := make([]fbReadTable, n)
+	for i := range out {
+		p := start + 4*i
+		out[i] = fbReadTable{r.t, r.buf, p + r.u32(p)}
+	}
+	return out
+}
+
+func (r fbReadTable) str(id int) string {
+	start, n := r.vector(id)
+	return string(r.buf[start : start+n])
+}
+
+func (r fbReadTable) u8(id int, def int) int {
+	if p := r.field(id); p != 0 {
+		return int(r.buf[p])
+	}
+	return def
+}
+
+func (r fbReadTable) i16(id int, def int) int {
+	if p := r.field(id); p != 0 {
+		return int(int16(r.u16(p)))
+	}
+	return def
+}
+
+func (r fbReadTable) i32(id int, def int) int {
+	if p := r.field(id); p != 0 {
+		return int(int32(r.u32(p)))
+	}
+	return def
+}
+
+func (r fbReadTable) i64(id int) int64 {
+	p := r.field(id)
+	if p == 0 {
+		return 0
+	}
+	if p%8 != 0 {
+		r.t.Errorf("scalaire 64 bits non aligné (position %d)", p)
+	}
+	return int64(binary.LittleEndian.Uint64(r.buf[p:]))
+}
+
+// structs64 lit un vecteur de structs formées de deux int64.
+func (r fbReadTable) structs64(id int) [][2]int64 {
+	start, n := r.vector(id)
+	if n > 0 && start%8 != 0 {
+		r.t.Errorf("vecteur de structs non aligné (position %d)", start)
+	}
+	out := make([][2]int64, n)
+	for i := range out {
+		p := start + 16*i
+		out[i] = [2]int64{int64(binary.LittleEndian.Uint64(r.buf[p:])), int64(binary.LittleEndian.Uint64(r.buf[p+8:]))}
+	}
+	return out
+}
+
+type arrowTestField struct {
+	name     string
+	nullable bool
+	typeID   int
+	typ      fbReadTable
+	metadata map[string]string
+}
+
+// readArrowStream décode un flux complet et retourne le schéma, le nombre de
+// lignes de chaque lot et les valeurs, colonne par colonne.
+func readArrowStream(t *testing.T, stream []byte) ([]arrowTestField, []int, [][]interface{}) {
+	t.Helper()
+	var fields []arrowTestField
+	var batches []int
+	var columns [][]interface{}
+
+	r := bytes.NewReader(stream)
+	for {
+		var prefix [8]byte
+		if _, err := r.Read(prefix[:]); err != nil {
+			t.Fatalf("flux tronqué : %v", err)
+		}
+		if binary.LittleEndian.Uint32(prefix[:]) != 0xffffffff {
+			t.Fatalf("marqueur de continuation attendu, reçu %x", prefix[:4])
+		}
+		metaLen := int(binary.LittleEndian.Uint32(prefix[4:]))
+		if metaLen == 0 {
+			break // fin de flux
+		}
+		if metaLen%8 != 0 {
+			t.Errorf("métadonnées de %d octets, multiple de 8 attendu", metaLen)
+		}
+		meta := make([]byte, metaLen)
+		r.Read(meta)
+
+		root := fbReadTable{t, meta, 0}
+		message := fbReadTable{t, meta, root.u32(0)}
+		if v := message.i16(0, 0); v != arrowMetadataV5 {
+			t.Fatalf("version %d", v)
+		}
+		body := make([]byte, message.i64(3))
+		r.Read(body)
+		header := message.table(2)
+
+		switch message.u8(1, 0) {
+		case arrowHeaderSchema:
+			for _, f := range header.tables(1) {
+				field := arrowTestField{
+					name:     f.str(0),
+					nullable: f.u8(1, 0) == 1,
+					typeID:   f.u8(2, 0),
+					typ:      f.table(3),
+					metadata: map[string]string{},
+				}
+				for _, kv := range f.tables(6) {
+					field.metadata[kv.str(0)] = kv.str(1)
+				}
+				fields = append(fields, field)
+			}
+			columns = make([][]interface{}, len(fields))
+
+		case arrowHeaderRecordBatch:
+			length := int(header.i64(0))
+			nodes, buffers := header.structs64(1), header.structs64(2)
+			batches = append(batches, length)
+			for _, b := range buffers {
+				if b[0]%8 != 0 || b[0]+b[1] > int64(len(body)) {
+					t.Fatalf("buffer %v hors du corps (%d octets) ou non aligné", b, len(body))
+				}
+			}
+			buf := func() []byte {
+				b := buffers[0]
+				buffers = buffers[1:]
+				return body[b[0] : b[0]+b[1]]
+			}
+			for i, f := range fields {
+				if int(nodes[i][0]) != length {
+					t.Errorf("colonne %s : %d lignes, %d attendues", f.name, nodes[i][0], length)
+				}
+				columns[i] = append(columns[i], decodeArrowColumn(t, f, length, int(nodes[i][1]), buf)...)
+			}
+
+		default:
+			t.Fatalf("message inattendu %d", message.u8(1, 0))
+		}
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d octets après la fin de flux", r.Len())
+	}
+	return fields, batches, columns
+}
+
+func bitSet(bitmap []byte, i int) bool {
+	return bitmap[i/8]&(1<<(i%8)) != 0
+}
+
+func decodeArrowColumn(t *testing.T, f arrowTestField, length, nullCount int, buf func() []byte) []interface{} {
+	validity := buf()
+	valid := func(i int) bool { return len(validity) == 0 || bitSet(validity, i) }
+
+	values := make([]interface{}, length)
+	switch f.typeID {
+	case arrowTypeUtf8, arrowTypeBinary:
+		offsets, data := buf(), buf()
+		for i := range values {
+			if valid(i) {
+				start := binary.LittleEndian.Uint32(offsets[4*i:])
+				end := binary.LittleEndian.Uint32(offsets[4*i+4:])
+				values[i] = string(data[start:end])
+			}
+		}
+
+	case arrowTypeBool:
+		data := buf()
+		for i := range values {
+			if valid(i) {
+				values[i] = bitSet(data, i)
+			}
+		}
+
+	case arrowTypeInt:
+		data := buf()
+		width := f.typ.i32(0, 0) / 8
+		if f.typ.u8(1, 0) != 1 {
+			t.Errorf("colonne %s : entier non signé", f.name)
+		}
+		for i := range values {
+			if !valid(i) {
+				continue
+			}
+			switch width {
+			case 2:
+				values[i] = int64(int16(binary.LittleEndian.Uint16(data[2*i:])))
+			case 4:
+				values[i] = int64(int32(binary.LittleEndian.Uint32(data[4*i:])))
+			case 8:
+				values[i] = int64(binary.LittleEndian.Uint64(data[8*i:]))
+			default:
+				t.Fatalf("colonne %s : largeur %d", f.name, width)
+			}
+		}
+
+	case arrowTypeFloatingPoint:
+		data := buf()
+		single := f.typ.i16(0, 0) == arrowPrecisionSingle
+		for i := range values {
+			if !valid(i) {
+				continue
+			}
+			if single {
+				values[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])))
+			} else {
+				values[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:]))
+			}
+		}
+
+	case arrowTypeDate:
+		data := buf()
+		if unit := f.typ.i16(0, 1); unit != arrowDateUnitDay { // MILLISECOND par défaut
+			t.Fatalf("colonne %s : unité de date %d", f.name, unit)
+		}
+		for i := range values {
+			if valid(i) {
+				days := int64(int32(binary.LittleEndian.Uint32(data[4*i:])))
+				values[i] = time.Unix(days*86400, 0).UTC()
+			}
+		}
+
+	case arrowTypeTimestamp:
+		data := buf()
+		if unit := f.typ.i16(0, 0); unit != arrowTimeUnitMicro {
+			t.Fatalf("colonne %s : unité %d", f.name, unit)
+		}
+		for i := range values {
+			if valid(i) {
+				values[i] = time.UnixMicro(int64(binary.LittleEndian.Uint64(data[8*i:]))).UTC()
+			}
+		}
+
+	default:
+		t.Fatalf("colonne %s : type Arrow %d inattendu", f.name, f.typeID)
+	}
+
+	nulls := 0
+	for _, v := range values {
+		if v == nil {
+			nulls++
+		}
+	}
+	if nulls != nullCount {
+		t.Errorf("colonne %s : null_count %d, %d valeurs nulles", f.name, nullCount, nulls)
+	}
+	return values
+}
+
+// Chaque type est écrit puis relu sur plus d'un lot, avec des valeurs nulles.
+func TestArrowResultWriterRoundTrip(t *testing.T) {
+	columns := []ColumnMeta{
+		{Name: "i2", Type: "INT2", OID: 21},
+		{Name: "i4", Type: "INT4", OID: 23},
+		{Name: "i8", Type: "INT8", OID: 20},
+		{Name: "f4", Type: "FLOAT4", OID: 700},
+		{Name: "f8", Type: "FLOAT8", OID: 701},
+		{Name: "ok", Type: "BOOL", OID: 16},
+		{Name: "jour", Type: "DATE", OID: 1082},
+		{Name: "ts", Type: "TIMESTAMP", OID: 1114},
+		{Name: "tstz", Type: "TIMESTAMPTZ", OID: 1184},
+		{Name: "data", Type: "BYTEA", OID: 17},
+		{Name: "label", Type: "TEXT", OID: 25},
+		{Name: "montant", Type: "NUMERIC", OID: 1700},
+	}
+	const rowCount = 2*arrowBatchSize + 300
+
+	paris := time.FixedZone("Europe/Paris", 3600)
+	rows := make([][]interface{}, rowCount)
+	for i := range rows {
+		n := int64(i)
+		rows[i] = []interface{}{
+			n%60000 - 30000,
+			n*100003 - (1 << 30),
+			(n - 1000) * 1e12,
+			float64(i) + 0.25,
+			float64(i) / 3,
+			i%3 == 0,
+			time.Date(1960, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i*13),
+			time.Date(2024, 1, 2, 3, 4, 5, 123456000, time.UTC).Add(time.Duration(i) * time.Minute),
+			time.Date(1969, 12, 31, 23, 0, 0, 0, paris).Add(time.Duration(i) * time.Hour),
+			string([]byte{0, byte(i), 0xff, '\n'}),
+			fmt.Sprintf("ligne é %d", i),
+			fmt.Sprintf("%d.%02d", i, i%100),
+		}
+		// Une colonne sur sept est nulle, en décalé d'une ligne à l'autre
+		for c := range rows[i] {
+			if (i+c)%7 == 0 {
+				rows[i][c] = nil
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	w := newArrowResultWriter(&out)
+	if err := w.WriteColumns(columns); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(QuerySummary{RowCount: rowCount}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	fields, batches, got := readArrowStream(t, out.Bytes())
+	if fmt.Sprint(batches) != fmt.Sprint([]int{arrowBatchSize, arrowBatchSize, 300}) {
+		t.Errorf("lots = %v", batches)
+	}
+	if len(fields) != len(columns) {
+		t.Fatalf("%d champs, %d attendus", len(fields), len(columns))
+	}
+	for c, f := range fields {
+		if f.name != columns[c].Name || !f.nullable {
+			t.Errorf("champ %d : %+v", c, f)
+		}
+		if f.metadata["pg_type"] != columns[c].Type || f.metadata["pg_oid"] != fmt.Sprint(columns[c].OID) {
+			t.Errorf("champ %s : métadonnées %v", f.name, f.metadata)
+		}
+	}
+	if tz := fields[8].typ.str(1); tz != "UTC" {
+		t.Errorf("fuseau TIMESTAMPTZ = %q", tz)
+	}
+	if fields[7].typ.field(1) != 0 {
+		t.Error("TIMESTAMP sans fuseau attendu")
+	}
+
+	for c := range columns {
+		if len(got[c]) != rowCount {
+			t.Fatalf("colonne %s : %d valeurs", columns[c].Name, len(got[c]))
+		}
+		for i, row := range rows {
+			want := row[c]
+			switch v := want.(type) {
+			case time.Time:
+				if g, ok := got[c][i].(time.Time); !ok || !g.Equal(v) {
+					t.Fatalf("%s[%d] = %v, attendu %v", columns[c].Name, i, got[c][i], v)
+				}
+				continue
+			case float64:
+				if columns[c].Type == "FLOAT4" {
+					want = float64(float32(v))
+				}
+			}
+			if got[c][i] != want {
+				t.Fatalf("%s[%d] = %#v, attendu %#v", columns[c].Name, i, got[c][i], want)
+			}
+		}
+	}
+}
+
+// Sans colonnes reçues (erreur avant le résultat), rien n'est écrit.
+func TestArrowResultWriterEmpty(t *testing.T) {
+	var out bytes.Buffer
+	w := newArrowResultWriter(&out)
+	if err := w.WriteColumns([]ColumnMeta{{Name: "x", Type: "INT4"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(QuerySummary{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	fields, batches, got := readArrowStream(t, out.Bytes())
+	if len(fields) != 1 || len(batches) != 0 || len(got[0]) != 0 {
+		t.Errorf("flux vide attendu : %v %v %v", fields, batches, got)
+	}
+}
@@ -3,37 +3,14 @@ package utils
 import (
 	"context"
 	"fmt"
-	"os"
-	"strconv"
 
 	"github.com/qdrant/go-client/qdrant"
 )
 
 func DeleteFromQdrantByFilter(ownerID, source string) error {
-	host := os.Getenv("QDRANT_HOST")
-	portStr := os.Getenv("QDRANT_PORT")
-	apiKey := os.Getenv("QDRANT_API_KEY")
-	collection := os.Getenv("QDRANT_COLLECTION")
-
-	if host == "" || portStr == "" || collection == "" {
-		return fmt.Errorf("env QDRANT_HOST, QDRANT_PORT ou QDRANT_COLLECTION manquantes")
-	}
-
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		return fmt.Errorf("QDRANT_PORT invalide : %w", err)
-	}
-
-	cfg := qdrant.Config{
-		Host:   host,
-		Port:   port,
-		APIKey: apiKey,
-		UseTLS: true,
-	}
-
-	client, err := qdrant.NewClient(&cfg)
+	client, collection, err := getQdrantClient()
 	if err != nil {
-		return fmt.Errorf("erreur création client Qdrant : %w", err)
+		return err
 	}
 
 	filter := &qdrant.Filter{
@@ -85,3 +62,38 @@ func DeleteFromQdrantByFilter(ownerID, source string) error {
 func protoBool(b bool) *bool {
 	return &b
 }
+
+// DeleteFromQdrantByDataID supprime les points d'une ligne (owner_id, source,
+// data_id), sauf ceux dont l'identifiant figure dans keepIDs.
+func DeleteFromQdrantByDataID(ownerID, source, dataID string, keepIDs ...string) error {
+	client, collection, err := getQdrantClient()
+	if err != nil {
+		return err
+	}
+
+	filter := &qdrant.Filter{
+		Must: []*qdrant.Condition{
+			qdrant.NewMatchKeyword("owner_id", ownerID),
+			qdrant.NewMatchKeyword("source", source),
+			qdrant.NewMatchKeyword("data_id", dataID),
+		},
+	}
+	if len(keepIDs) > 0 {
+		ids := make([]*qdrant.PointId, len(keepIDs))
+		for i, id := range keepIDs {
+			ids[i] = qdrant.NewIDUUID(id)
+		}
+		filter.MustNot = []*qdrant.Condition{qdrant.NewHasID(ids...)}
+	}
+
+	_, err = client.Delete(context.Background(), &qdrant.DeletePoints{
+		CollectionName: collection,
+		Points:         qdrant.NewPointsSelectorFilter(filter),
+		Wait:           protoBool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("échec suppression Qdrant : %w", err)
+	}
+
+	return nil
+}
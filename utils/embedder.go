@@ -2,53 +2,224 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
-type EmbedRequest struct {
-	Texts []string `json:"texts"`
-	Model string   `json:"model"`
+// Embedder transforme des textes en vecteurs denses.
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+	EmbedBatch(texts []string) ([][]float32, error)
+	Dimension() int
+	ModelName() string
 }
 
-type EmbedResponse struct {
-	Embeddings [][]float32 `json:"embeddings"`
+const (
+	defaultEmbedderURL       = "https://madachat-embedder.hf.space/embed"
+	defaultEmbedderDimension = 384
+)
+
+var (
+	embedderMu      sync.RWMutex
+	currentEmbedder Embedder
+)
+
+// SetEmbedder remplace l'embedder utilisé par le service (utile pour les tests).
+func SetEmbedder(e Embedder) {
+	embedderMu.Lock()
+	defer embedderMu.Unlock()
+	currentEmbedder = e
+}
+
+// GetEmbedder retourne l'embedder configuré, en le construisant depuis
+// l'environnement au premier appel.
+func GetEmbedder() (Embedder, error) {
+	embedderMu.RLock()
+	e := currentEmbedder
+	embedderMu.RUnlock()
+	if e != nil {
+		return e, nil
+	}
+
+	embedderMu.Lock()
+	defer embedderMu.Unlock()
+	if currentEmbedder != nil {
+		return currentEmbedder, nil
+	}
+	e, err := NewEmbedderFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	currentEmbedder = e
+	return e, nil
+}
+
+// NewEmbedderFromEnv construit l'embedder à partir des variables :
+// EMBEDDER_PROVIDER (hfspace, openai, ollama, tei), EMBEDDER_URL,
+// EMBEDDER_MODEL, EMBEDDER_API_KEY et EMBEDDER_DIMENSION.
+func NewEmbedderFromEnv() (Embedder, error) {
+	provider := strings.ToLower(os.Getenv("EMBEDDER_PROVIDER"))
+	url := os.Getenv("EMBEDDER_URL")
+	model := os.Getenv("EMBEDDER_MODEL")
+	apiKey := os.Getenv("EMBEDDER_API_KEY")
+
+	dimension := defaultEmbedderDimension
+	if dimStr := os.Getenv("EMBEDDER_DIMENSION"); dimStr != "" {
+		d, err := strconv.Atoi(dimStr)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("EMBEDDER_DIMENSION invalide : %q", dimStr)
+		}
+		dimension = d
+	}
+
+	switch provider {
+	case "", "hfspace":
+		if url == "" {
+			url = defaultEmbedderURL
+		}
+		return &HFSpaceEmbedder{URL: url, Model: model, Dim: dimension}, nil
+	case "openai":
+		if url == "" {
+			url = "https://api.openai.com/v1/embeddings"
+		}
+		if model == "" {
+			return nil, fmt.Errorf("EMBEDDER_MODEL requis pour le fournisseur openai")
+		}
+		return &OpenAIEmbedder{URL: url, Model: model, APIKey: apiKey, Dim: dimension}, nil
+	case "ollama":
+		if url == "" {
+			url = "http://localhost:11434/api/embed"
+		}
+		if model == "" {
+			return nil, fmt.Errorf("EMBEDDER_MODEL requis pour le fournisseur ollama")
+		}
+		return &OllamaEmbedder{URL: url, Model: model, Dim: dimension}, nil
+	case "tei":
+		if url == "" {
+			return nil, fmt.Errorf("EMBEDDER_URL requis pour le fournisseur tei")
+		}
+		return &TEIEmbedder{URL: url, Model: model, APIKey: apiKey, Dim: dimension}, nil
+	default:
+		return nil, fmt.Errorf("EMBEDDER_PROVIDER inconnu : %q", provider)
+	}
 }
 
-func Embed(text string) ([]float32, error) {
-	url := "https://madachat-embedder.hf.space/embed"
+var embedderHTTPClient = &http.Client{Timeout: 60 * time.Second}
 
-	payload := EmbedRequest{
-		Texts: []string{text},
-		Model: "",
+// postJSON envoie payload en JSON à url et décode la réponse dans out.
+func postJSON(url, apiKey string, payload interface{}, out interface{}) error {
+	if err := postJSONWith(embedderHTTPClient, url, apiKey, payload, out); err != nil {
+		return fmt.Errorf("embedder : %w", err)
 	}
+	return nil
+}
+
+// postJSONWith est postJSON avec un client HTTP choisi (délai propre).
+func postJSONWith(client *http.Client, url, apiKey string, payload interface{}, out interface{}) error {
+	return postJSONContext(context.Background(), client, url, apiKey, payload, out)
+}
 
+// postJSONContext est postJSONWith interrompu par l'annulation de ctx.
+func postJSONContext(ctx context.Context, client *http.Client, url, apiKey string, payload interface{}, out interface{}) error {
 	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return nil, fmt.Errorf("erreur encodage JSON: %w", err)
+		return fmt.Errorf("erreur encodage JSON: %w", err)
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("erreur requête HTTP embedder: %w", err)
+		return fmt.Errorf("erreur création requête: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("erreur requête HTTP: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("embedder status %d: %s", resp.StatusCode, string(body))
+		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
 	}
 
-	var result EmbedResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("erreur parsing réponse embedder: %w", err)
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("erreur parsing réponse: %w", err)
 	}
+	return nil
+}
+
+// checkEmbeddings vérifie que l'embedder a renvoyé un vecteur non vide par
+// texte, de la dimension configurée (la collection Qdrant rejetterait les
+// autres).
+func checkEmbeddings(embeddings [][]float32, expected, dimension int) error {
+	if len(embeddings) != expected {
+		return fmt.Errorf("l'embedder a renvoyé %d vecteurs pour %d textes", len(embeddings), expected)
+	}
+	for _, v := range embeddings {
+		if len(v) == 0 {
+			return fmt.Errorf("vecteur vide reçu depuis l'embedder")
+		}
+		if dimension > 0 && len(v) != dimension {
+			return fmt.Errorf("l'embedder a renvoyé un vecteur de dimension %d, %d attendue (EMBEDDER_DIMENSION)", len(v), dimension)
+		}
+	}
+	return nil
+}
 
-	if len(result.Embeddings) == 0 || len(result.Embeddings[0]) == 0 {
-		return nil, fmt.Errorf("vecteur vide reçu depuis l'embedder")
+// embedOne applique EmbedBatch à un seul texte.
+func embedOne(e Embedder, text string) ([]float32, error) {
+	vectors, err := e.EmbedBatch([]string{text})
+	if err != nil {
+		return nil, err
 	}
+	return vectors[0], nil
+}
 
-	return result.Embeddings[0], nil
+// --- Espace HuggingFace (protocole historique) ---
+
+type EmbedRequest struct {
+	Texts []string `json:"texts"`
+	Model string   `json:"model"`
 }
+
+type EmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// HFSpaceEmbedder parle le protocole {"texts": [...], "model": ...} de l'espace
+// madachat-embedder.
+type HFSpaceEmbedder struct {
+	URL   string
+	Model string
+	Dim   int
+}
+
+func (e *HFSpaceEmbedder) Embed(text string) ([]float32, error) {
+	return embedOne(e, text)
+}
+
+func (e *HFSpaceEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	var result EmbedResponse
+	if err := postJSON(e.URL, "", EmbedRequest{Texts: texts, Model: e.Model}, &result); err != nil {
+		return nil, err
+	}
+	if err := checkEmbeddings(result.Embeddings, len(texts), e.Dim); err != nil {
+		return nil, err
+	}
+	return result.Embeddings, nil
+}
+
+func (e *HFSpaceEmbedder) Dimension() int    { return e.Dim }
+func (e *HFSpaceEmbedder) ModelName() string { return e.Model }
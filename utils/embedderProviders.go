@@ -0,0 +1,124 @@
+package utils
+
+import "fmt"
+
+// --- API compatible OpenAI (/v1/embeddings) ---
+
+// OpenAIEmbedder appelle un endpoint /v1/embeddings compatible OpenAI
+// (OpenAI, vLLM, LocalAI, LiteLLM...).
+type OpenAIEmbedder struct {
+	URL    string
+	Model  string
+	APIKey string
+	Dim    int
+}
+
+type openAIEmbedRequest struct {
+	Input []string `json:"input"`
+	Model string   `json:"model"`
+}
+
+type openAIEmbedResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+func (e *OpenAIEmbedder) Embed(text string) ([]float32, error) {
+	return embedOne(e, text)
+}
+
+func (e *OpenAIEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	var result openAIEmbedResponse
+	if err := postJSON(e.URL, e.APIKey, openAIEmbedRequest{Input: texts, Model: e.Model}, &result); err != nil {
+		return nil, err
+	}
+
+	// L'API ne garantit pas l'ordre : on replace chaque vecteur à son index
+	embeddings := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("index d'embedding hors limites : %d", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	if err := checkEmbeddings(embeddings, len(texts), e.Dim); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
+
+func (e *OpenAIEmbedder) Dimension() int    { return e.Dim }
+func (e *OpenAIEmbedder) ModelName() string { return e.Model }
+
+// --- Ollama (/api/embed) ---
+
+// OllamaEmbedder appelle l'endpoint /api/embed d'Ollama.
+type OllamaEmbedder struct {
+	URL   string
+	Model string
+	Dim   int
+}
+
+type ollamaEmbedRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type ollamaEmbedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+func (e *OllamaEmbedder) Embed(text string) ([]float32, error) {
+	return embedOne(e, text)
+}
+
+func (e *OllamaEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	var result ollamaEmbedResponse
+	if err := postJSON(e.URL, "", ollamaEmbedRequest{Model: e.Model, Input: texts}, &result); err != nil {
+		return nil, err
+	}
+	if err := checkEmbeddings(result.Embeddings, len(texts), e.Dim); err != nil {
+		return nil, err
+	}
+	return result.Embeddings, nil
+}
+
+func (e *OllamaEmbedder) Dimension() int    { return e.Dim }
+func (e *OllamaEmbedder) ModelName() string { return e.Model }
+
+// --- HuggingFace text-embeddings-inference (/embed) ---
+
+// TEIEmbedder appelle l'endpoint /embed de text-embeddings-inference.
+type TEIEmbedder struct {
+	URL    string
+	Model  string
+	APIKey string
+	Dim    int
+}
+
+type teiEmbedRequest struct {
+	Inputs    []string `json:"inputs"`
+	Normalize bool     `json:"normalize"`
+	Truncate  bool     `json:"truncate"`
+}
+
+func (e *TEIEmbedder) Embed(text string) ([]float32, error) {
+	return embedOne(e, text)
+}
+
+func (e *TEIEmbedder) EmbedBatch(texts []string) ([][]float32, error) {
+	var result [][]float32
+	payload := teiEmbedRequest{Inputs: texts, Normalize: true, Truncate: true}
+	if err := postJSON(e.URL, e.APIKey, payload, &result); err != nil {
+		return nil, err
+	}
+	if err := checkEmbeddings(result, len(texts), e.Dim); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (e *TEIEmbedder) Dimension() int    { return e.Dim }
+func (e *TEIEmbedder) ModelName() string { return e.Model }
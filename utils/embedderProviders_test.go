@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeEmbedServer répond response à chaque requête et décode le corps reçu
+// dans request.
+func fakeEmbedServer(t *testing.T, request interface{}, status int, response string) (string, *http.Header) {
+	t.Helper()
+	var last http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &last
+}
+
+func TestOpenAIEmbedderEmbedBatch(t *testing.T) {
+	var req openAIEmbedRequest
+	// Réponse dans le désordre : chaque vecteur est replacé à son index
+	url, header := fakeEmbedServer(t, &req, http.StatusOK, `{"data": [
+		{"index": 1, "embedding": [0.3, 0.4]},
+		{"index": 0, "embedding": [0.1, 0.2]}]}`)
+	e := &OpenAIEmbedder{URL: url, Model: "text-embedding-3-small", APIKey: "secret", Dim: 2}
+
+	got, err := e.EmbedBatch([]string{"un", "deux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]float32{{0.1, 0.2}, {0.3, 0.4}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("vecteurs %v, attendu %v", got, want)
+	}
+	if req.Model != "text-embedding-3-small" || !reflect.DeepEqual(req.Input, []string{"un", "deux"}) {
+		t.Errorf("requête inattendue : %+v", req)
+	}
+	if header.Get("Authorization") != "Bearer secret" {
+		t.Errorf("en-tête Authorization : %q", header.Get("Authorization"))
+	}
+}
+
+func TestTEIEmbedderEmbedBatch(t *testing.T) {
+	var req teiEmbedRequest
+	url, header := fakeEmbedServer(t, &req, http.StatusOK, `[[1, 0, 0], [0, 1, 0]]`)
+	e := &TEIEmbedder{URL: url, Dim: 3}
+
+	got, err := e.EmbedBatch([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]float32{{1, 0, 0}, {0, 1, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("vecteurs %v, attendu %v", got, want)
+	}
+	if !reflect.DeepEqual(req.Inputs, []string{"a", "b"}) || !req.Normalize || !req.Truncate {
+		t.Errorf("requête inattendue : %+v", req)
+	}
+	if header.Get("Authorization") != "" {
+		t.Errorf("Authorization sans clé : %q", header.Get("Authorization"))
+	}
+}
+
+func TestEmbedderResponseErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		status   int
+		response string
+		msg      string
+	}{
+		{"dimension openai", "openai", http.StatusOK, `{"data": [{"index": 0, "embedding": [0.1, 0.2, 0.3]}]}`, "dimension 3, 2 attendue"},
+		{"index hors limites", "openai", http.StatusOK, `{"data": [{"index": 4, "embedding": [0.1, 0.2]}]}`, "hors limites"},
+		{"vecteur manquant", "openai", http.StatusOK, `{"data": []}`, "vecteur vide"},
+		{"statut d'erreur", "openai", http.StatusUnauthorized, `{"error": "clé invalide"}`, "status 401"},
+		{"dimension tei", "tei", http.StatusOK, `[[1, 0, 0]]`, "dimension 3, 2 attendue"},
+		{"nombre de vecteurs tei", "tei", http.StatusOK, `[[1, 0], [0, 1]]`, "2 vecteurs pour 1 textes"},
+		{"json invalide tei", "tei", http.StatusOK, `{"embeddings": []}`, "erreur parsing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req map[string]interface{}
+			url, _ := fakeEmbedServer(t, &req, tt.status, tt.response)
+			var e Embedder = &OpenAIEmbedder{URL: url, Model: "m", Dim: 2}
+			if tt.provider == "tei" {
+				e = &TEIEmbedder{URL: url, Dim: 2}
+			}
+			_, err := e.Embed("texte")
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("erreur contenant %q attendue, reçu %v", tt.msg, err)
+			}
+		})
+	}
+}
+
+func TestNewEmbedderFromEnv(t *testing.T) {
+	t.Setenv("EMBEDDER_PROVIDER", "tei")
+	t.Setenv("EMBEDDER_URL", "http://tei:8080/embed")
+	t.Setenv("EMBEDDER_DIMENSION", "768")
+	e, err := NewEmbedderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tei, ok := e.(*TEIEmbedder); !ok || tei.URL != "http://tei:8080/embed" || e.Dimension() != 768 {
+		t.Errorf("embedder inattendu : %#v", e)
+	}
+
+	t.Setenv("EMBEDDER_DIMENSION", "-1")
+	if _, err := NewEmbedderFromEnv(); err == nil || !strings.Contains(err.Error(), "EMBEDDER_DIMENSION") {
+		t.Errorf("dimension négative acceptée : %v", err)
+	}
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// fakeResult est la réponse du faux serveur à une requête : description des
+// lignes et valeurs (texte).
+type fakeResult struct {
+	fields []pgproto3.FieldDescription
+	rows   [][]string
+}
+
+// fakePGField décrit une colonne du faux serveur.
+func fakePGField(name string, typeOID, tableOID uint32, attnum uint16) pgproto3.FieldDescription {
+	return pgproto3.FieldDescription{Name: []byte(name), DataTypeOID: typeOID, TableOID: tableOID, TableAttributeNumber: attnum, DataTypeSize: -1, TypeModifier: -1}
+}
+
+// startFakePG démarre un serveur parlant le protocole PostgreSQL, suffisant
+// pour pgx : authentification immédiate, protocoles simple et étendu.
+// respond retourne le résultat d'une requête (nil : pas de lignes) ; la
+// fonction retournée avec la base liste les requêtes reçues.
+func startFakePG(t *testing.T, respond func(query string) *fakeResult) (*sql.DB, func() []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	log := &fakePGLog{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakePG(conn, respond, log)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	db, err := sql.Open("pgx", fmt.Sprintf("host=127.0.0.1 port=%d user=u password=p dbname=d sslmode=disable", addr.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, log.queries
+}
+
+// fakePGLog garde les requêtes reçues par toutes les connexions.
+type fakePGLog struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (l *fakePGLog) add(query string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.list = append(l.list, query)
+}
+
+func (l *fakePGLog) queries() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.list...)
+}
+
+func serveFakePG(conn net.Conn, respond func(string) *fakeResult, log *fakePGLog) {
+	defer conn.Close()
+	b := pgproto3.NewBackend(conn, conn)
+	if _, err := b.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	b.Send(&pgproto3.AuthenticationOk{})
+	b.Send(&pgproto3.ParameterStatus{Name: "server_version", Value: "16.0"})
+	b.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	b.Flush()
+
+	txStatus := byte('I')
+	statements := map[string]string{}
+	portals := map[string]string{}
+	result := func(query string) *fakeResult {
+		if r := respond(query); r != nil {
+			return r
+		}
+		return &fakeResult{}
+	}
+	sendRows := func(r *fakeResult) {
+		for _, row := range r.rows {
+			values := make([][]byte, len(row))
+			for i, v := range row {
+				values[i] = []byte(v)
+			}
+			b.Send(&pgproto3.DataRow{Values: values})
+		}
+		b.Send(&pgproto3.CommandComplete{CommandTag: []byte(fmt.Sprintf("SELECT %d", len(r.rows)))})
+	}
+
+	for {
+		msg, err := b.Receive()
+		if err != nil {
+			return
+		}
+		switch m := msg.(type) {
+		case *pgproto3.Query:
+			log.add(m.String)
+			lower := strings.ToLower(m.String)
+			switch {
+			case strings.HasPrefix(lower, "begin"):
+				txStatus = 'T'
+				b.Send(&pgproto3.CommandComplete{CommandTag: []byte("BEGIN")})
+			case strings.HasPrefix(lower, "rollback"), strings.HasPrefix(lower, "commit"):
+				txStatus = 'I'
+				b.Send(&pgproto3.CommandComplete{CommandTag: []byte("ROLLBACK")})
+			case strings.HasPrefix(lower, "set"):
+				b.Send(&pgproto3.CommandComplete{CommandTag: []byte("SET")})
+			default:
+				r := result(m.String)
+				b.Send(&pgproto3.RowDescription{Fields: r.fields})
+				sendRows(r)
+			}
+			b.Send(&pgproto3.ReadyForQuery{TxStatus: txStatus})
+		case *pgproto3.Parse:
+			log.add(m.Query)
+			statements[m.Name] = m.Query
+			b.Send(&pgproto3.ParseComplete{})
+		case *pgproto3.Describe:
+			query := statements[m.Name]
+			if m.ObjectType == 'P' {
+				query = portals[m.Name]
+			} else {
+				params := make([]uint32, strings.Count(query, "$"))
+				for i := range params {
+					params[i] = 25 // text
+				}
+				b.Send(&pgproto3.ParameterDescription{ParameterOIDs: params})
+			}
+			if r := result(query); len(r.fields) > 0 {
+				b.Send(&pgproto3.RowDescription{Fields: r.fields})
+			} else {
+				b.Send(&pgproto3.NoData{})
+			}
+		case *pgproto3.Bind:
+			portals[m.DestinationPortal] = statements[m.PreparedStatement]
+			b.Send(&pgproto3.BindComplete{})
+		case *pgproto3.Execute:
+			sendRows(result(portals[m.Portal]))
+		case *pgproto3.Close:
+			b.Send(&pgproto3.CloseComplete{})
+		case *pgproto3.Sync:
+			b.Send(&pgproto3.ReadyForQuery{TxStatus: txStatus})
+		case *pgproto3.Terminate:
+			return
+		}
+		if err := b.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChatMessage est un message de conversation au format OpenAI.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatOptions règle une génération.
+type ChatOptions struct {
+	Temperature *float64
+	MaxTokens   int
+}
+
+// Usage est la consommation de tokens rapportée par le modèle.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// LLM génère une réponse à partir d'une conversation. Les appels s'arrêtent
+// dès que ctx est annulé (client HTTP déconnecté) ; ChatStream appelle
+// onDelta pour chaque fragment de texte reçu et s'arrête aussi quand onDelta
+// retourne une erreur.
+type LLM interface {
+	Chat(ctx context.Context, messages []ChatMessage, opts ChatOptions) (string, error)
+	ChatStream(ctx context.Context, messages []ChatMessage, opts ChatOptions, onDelta func(string) error) (Usage, error)
+	ModelName() string
+}
+
+var (
+	llmMu      sync.RWMutex
+	currentLLM LLM
+)
+
+// SetLLM remplace le modèle de langage utilisé par le service (utile pour les tests).
+func SetLLM(l LLM) {
+	llmMu.Lock()
+	defer llmMu.Unlock()
+	currentLLM = l
+}
+
+// GetLLM retourne le modèle de langage configuré, en le construisant depuis
+// l'environnement au premier appel.
+func GetLLM() (LLM, error) {
+	llmMu.RLock()
+	l := currentLLM
+	llmMu.RUnlock()
+	if l != nil {
+		return l, nil
+	}
+
+	llmMu.Lock()
+	defer llmMu.Unlock()
+	if currentLLM != nil {
+		return currentLLM, nil
+	}
+	l, err := NewLLMFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	currentLLM = l
+	return l, nil
+}
+
+// NewLLMFromEnv construit le client chat à partir des variables : LLM_URL
+// (endpoint /v1/chat/completions compatible OpenAI), LLM_MODEL, LLM_API_KEY
+// et LLM_TIMEOUT (secondes, défaut 120). LLM_URL peut pointer vers un faux
+// serveur local pour les tests.
+func NewLLMFromEnv() (LLM, error) {
+	url := os.Getenv("LLM_URL")
+	if url == "" {
+		url = "https://api.openai.com/v1/chat/completions"
+	}
+	model := os.Getenv("LLM_MODEL")
+	if model == "" {
+		return nil, fmt.Errorf("LLM_MODEL requis pour la génération de réponses")
+	}
+
+	timeout := 120 * time.Second
+	if s := os.Getenv("LLM_TIMEOUT"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("LLM_TIMEOUT invalide : %q", s)
+		}
+		timeout = time.Duration(n) * time.Second
+	}
+
+	return &OpenAIChatClient{
+		URL:    url,
+		Model:  model,
+		APIKey: os.Getenv("LLM_API_KEY"),
+		Client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// --- API compatible OpenAI (/v1/chat/completions) ---
+
+// OpenAIChatClient appelle un endpoint /v1/chat/completions compatible OpenAI
+// (OpenAI, vLLM, Ollama, LocalAI, LiteLLM...).
+type OpenAIChatClient struct {
+	URL    string
+	Model  string
+	APIKey string
+	Client *http.Client
+}
+
+type openAIChatRequest struct {
+	Model         string               `json:"model"`
+	Messages      []ChatMessage        `json:"messages"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIChatChunk est un événement du flux de /v1/chat/completions.
+type openAIChatChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message ChatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (c *OpenAIChatClient) Chat(ctx context.Context, messages []ChatMessage, opts ChatOptions) (string, error) {
+	payload := openAIChatRequest{
+		Model:       c.Model,
+		Messages:    messages,
+		Temperature: opts.Temperature,
+		MaxTokens:   opts.MaxTokens,
+	}
+	var result openAIChatResponse
+	if err := postJSONContext(ctx, c.Client, c.URL, c.APIKey, payload, &result); err != nil {
+		return "", fmt.Errorf("LLM : %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("LLM : aucune réponse générée")
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+func (c *OpenAIChatClient) ModelName() string { return c.Model }
+
+// ChatStream demande une réponse en flux (stream: true) et relaie chaque
+// fragment à onDelta. Le flux n'a pas de délai global : il est borné par ctx,
+// annulé notamment quand le client HTTP se déconnecte.
+func (c *OpenAIChatClient) ChatStream(ctx context.Context, messages []ChatMessage, opts ChatOptions, onDelta func(string) error) (Usage, error) {
+	var usage Usage
+	payload := openAIChatRequest{
+		Model:         c.Model,
+		Messages:      messages,
+		Temperature:   opts.Temperature,
+		MaxTokens:     opts.MaxTokens,
+		Stream:        true,
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+	}
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return usage, fmt.Errorf("erreur encodage JSON: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(jsonData))
+	if err != nil {
+		return usage, fmt.Errorf("LLM : erreur création requête: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	client := &http.Client{}
+	if c.Client != nil {
+		client.Transport = c.Client.Transport
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return usage, fmt.Errorf("LLM : erreur requête HTTP: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return usage, fmt.Errorf("LLM : status %d: %s", resp.StatusCode, string(body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "[DONE]" {
+			return usage, nil
+		}
+
+		var chunk openAIChatChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return usage, fmt.Errorf("LLM : événement de flux invalide: %w", err)
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return usage, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		if ctx.Err() != nil {
+			return usage, ctx.Err()
+		}
+		return usage, fmt.Errorf("LLM : erreur lecture du flux: %w", err)
+	}
+	return usage, nil
+}
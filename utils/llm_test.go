@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeLLMServer simule un endpoint /v1/chat/completions compatible OpenAI et
+// mémorise les en-têtes de la dernière requête reçue.
+func fakeLLMServer(t *testing.T, handler func(w http.ResponseWriter, req openAIChatRequest)) (*OpenAIChatClient, *http.Header) {
+	t.Helper()
+	var last http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r.Header.Clone()
+		var req openAIChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handler(w, req)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := &OpenAIChatClient{
+		URL:    srv.URL + "/v1/chat/completions",
+		Model:  "fake-model",
+		APIKey: "secret",
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+	return client, &last
+}
+
+func TestOpenAIChatClientChat(t *testing.T) {
+	var got openAIChatRequest
+	client, last := fakeLLMServer(t, func(w http.ResponseWriter, req openAIChatRequest) {
+		got = req
+		fmt.Fprint(w, `{"choices": [{"message": {"role": "assistant", "content": "Bonjour [1]"}}]}`)
+	})
+
+	temperature := 0.2
+	answer, err := client.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "Salut"}},
+		ChatOptions{Temperature: &temperature, MaxTokens: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer != "Bonjour [1]" {
+		t.Errorf("réponse = %q", answer)
+	}
+	if got.Model != "fake-model" || len(got.Messages) != 1 || got.Messages[0].Content != "Salut" {
+		t.Errorf("requête inattendue : %+v", got)
+	}
+	if got.Temperature == nil || *got.Temperature != 0.2 || got.MaxTokens != 50 || got.Stream {
+		t.Errorf("options inattendues : %+v", got)
+	}
+	if auth := last.Get("Authorization"); auth != "Bearer secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+}
+
+func TestOpenAIChatClientChatErrors(t *testing.T) {
+	client, _ := fakeLLMServer(t, func(w http.ResponseWriter, req openAIChatRequest) {
+		if req.Messages[0].Content == "vide" {
+			fmt.Fprint(w, `{"choices": []}`)
+			return
+		}
+		http.Error(w, "surcharge", http.StatusServiceUnavailable)
+	})
+
+	if _, err := client.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "x"}}, ChatOptions{}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("erreur attendue avec le status 503, reçu %v", err)
+	}
+	if _, err := client.Chat(context.Background(), []ChatMessage{{Role: "user", Content: "vide"}}, ChatOptions{}); err == nil {
+		t.Error("erreur attendue pour une réponse sans choix")
+	}
+}
+
+// L'annulation du contexte (client déconnecté) interrompt l'appel sans
+// attendre le délai du client HTTP.
+func TestOpenAIChatClientChatCancel(t *testing.T) {
+	release := make(chan struct{})
+	client, _ := fakeLLMServer(t, func(w http.ResponseWriter, req openAIChatRequest) {
+		<-release
+	})
+	// Enregistré après le serveur : libère le handler avant sa fermeture
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := client.Chat(ctx, []ChatMessage{{Role: "user", Content: "x"}}, ChatOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("context.Canceled attendu, reçu %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("annulation trop lente : %s", elapsed)
+	}
+}
+
+func TestOpenAIChatClientChatStream(t *testing.T) {
+	var got openAIChatRequest
+	client, _ := fakeLLMServer(t, func(w http.ResponseWriter, req openAIChatRequest) {
+		got = req
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range []string{
+			`{"choices": [{"delta": {"role": "assistant"}}]}`,
+			`{"choices": [{"delta": {"content": "Bon"}}]}`,
+			`{"choices": [{"delta": {"content": "jour [2]"}}]}`,
+			`{"choices": [], "usage": {"prompt_tokens": 12, "completion_tokens": 3, "total_tokens": 15}}`,
+			`[DONE]`,
+		} {
+			fmt.Fprintf(w, "data: %s\n\n", event)
+		}
+	})
+
+	var deltas []string
+	usage, err := client.ChatStream(context.Background(), []ChatMessage{{Role: "user", Content: "Salut"}}, ChatOptions{},
+		func(delta string) error {
+			deltas = append(deltas, delta)
+			return nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(deltas, "") != "Bonjour [2]" || len(deltas) != 2 {
+		t.Errorf("fragments = %q", deltas)
+	}
+	if usage.TotalTokens != 15 || usage.PromptTokens != 12 || usage.CompletionTokens != 3 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if !got.Stream || got.StreamOptions == nil || !got.StreamOptions.IncludeUsage {
+		t.Errorf("requête de flux inattendue : %+v", got)
+	}
+}
+
+// Une erreur de onDelta (écriture vers le client impossible) arrête le flux.
+func TestOpenAIChatClientChatStreamStop(t *testing.T) {
+	client, _ := fakeLLMServer(t, func(w http.ResponseWriter, req openAIChatRequest) {
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "data: {\"choices\": [{\"delta\": {\"content\": \"%d\"}}]}\n\n", i)
+		}
+	})
+
+	stop := errors.New("client parti")
+	calls := 0
+	_, err := client.ChatStream(context.Background(), []ChatMessage{{Role: "user", Content: "x"}}, ChatOptions{},
+		func(string) error {
+			calls++
+			return stop
+		})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("arrêt attendu au premier fragment : err=%v, appels=%d", err, calls)
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultMMRLambda équilibre pertinence et diversité à parts égales.
+const DefaultMMRLambda = 0.5
+
+// cosine retourne la similarité cosinus de deux vecteurs, 0 si l'un est nul
+// ou si leurs dimensions diffèrent.
+func cosine(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// SelectMMR choisit jusqu'à n résultats par maximal marginal relevance : à
+// chaque étape, le candidat qui maximise
+// lambda*sim(requête, d) - (1-lambda)*max sim(d, déjà choisis).
+// Les résultats sans vecteur sont placés après les autres, dans leur ordre.
+func SelectMMR(query []float32, candidates []SearchResult, n int, lambda float64) []SearchResult {
+	var pool, withoutVector []SearchResult
+	for _, c := range candidates {
+		if len(c.Vector) == 0 {
+			withoutVector = append(withoutVector, c)
+		} else {
+			pool = append(pool, c)
+		}
+	}
+
+	relevance := make([]float64, len(pool))
+	for i, c := range pool {
+		relevance[i] = cosine(query, c.Vector)
+	}
+	// maxSim[i] est la plus forte similarité de pool[i] avec un résultat choisi
+	maxSim := make([]float64, len(pool))
+	used := make([]bool, len(pool))
+
+	selected := make([]SearchResult, 0, n)
+	for len(selected) < n && len(selected) < len(pool) {
+		best, bestScore := -1, math.Inf(-1)
+		for i := range pool {
+			if used[i] {
+				continue
+			}
+			score := lambda*relevance[i] - (1-lambda)*maxSim[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		used[best] = true
+		selected = append(selected, pool[best])
+		for i := range pool {
+			if !used[i] {
+				maxSim[i] = math.Max(maxSim[i], cosine(pool[i].Vector, pool[best].Vector))
+			}
+		}
+	}
+
+	for _, c := range withoutVector {
+		if len(selected) >= n {
+			break
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+// SearchQdrantMMR récupère candidates résultats avec leurs vecteurs puis
+// sélectionne offset + TopK résultats diversifiés par MMR avant d'appliquer
+// offset et TopK.
+func SearchQdrantMMR(opts SearchOptions, lambda float64, candidates int) ([]SearchResult, error) {
+	if lambda < 0 || lambda > 1 {
+		return nil, fmt.Errorf("lambda MMR doit être compris entre 0 et 1")
+	}
+	opts.WithVectors = true
+	results, _, err := searchCandidates(opts, candidates, false)
+	if err != nil {
+		return nil, err
+	}
+	selected := SelectMMR(opts.Vector, results, opts.Offset+opts.TopK, lambda)
+	return pageResults(selected, opts.Offset, opts.TopK), nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSelectMMR(t *testing.T) {
+	query := []float32{1, 0.2}
+	candidates := []SearchResult{
+		{ID: "a", Vector: []float32{1, 0}},
+		{ID: "a-doublon", Vector: []float32{1, 0}},
+		{ID: "b", Vector: []float32{0.6, 0.8}},
+		{ID: "c", Vector: []float32{0, 1}},
+		{ID: "sans-vecteur"},
+	}
+	ids := func(results []SearchResult) []interface{} {
+		out := make([]interface{}, len(results))
+		for i, r := range results {
+			out[i] = r.ID
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		n      int
+		lambda float64
+		want   []interface{}
+	}{
+		// lambda 1 : pertinence seule, le doublon suit l'original
+		{"pertinence seule", 5, 1, []interface{}{"a", "a-doublon", "b", "c", "sans-vecteur"}},
+		// lambda 0 : diversité seule, le doublon arrive en dernier
+		{"diversité seule", 4, 0, []interface{}{"a", "c", "b", "a-doublon"}},
+		// Équilibre : le doublon, aussi pertinent que l'original, est écarté
+		// au profit d'un résultat différent
+		{"doublons écartés", 2, DefaultMMRLambda, []interface{}{"a", "c"}},
+		{"n nul", 0, DefaultMMRLambda, []interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(SelectMMR(query, candidates, tt.n, tt.lambda))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sélection %v, attendu %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCosine(t *testing.T) {
+	if got := cosine([]float32{1, 0}, []float32{2, 0}); got != 1 {
+		t.Errorf("vecteurs colinéaires : %v", got)
+	}
+	if got := cosine([]float32{1, 0}, []float32{0, 0}); got != 0 {
+		t.Errorf("vecteur nul : %v", got)
+	}
+	if got := cosine([]float32{1, 0}, []float32{1, 0, 0}); got != 0 {
+		t.Errorf("dimensions différentes : %v", got)
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+)
+
+const nl2sqlSystemPrompt = `Tu traduis des questions en une requête SQL PostgreSQL.
+Règles :
+- une seule requête SELECT (ou WITH ... SELECT), sans point-virgule final ;
+- n'utilise que les tables et colonnes du schéma fourni ;
+- les identifiants contenant des majuscules doivent être entre guillemets doubles, par exemple "FirstName" ;
+- n'invente aucune valeur absente de la question.
+Réponds uniquement avec un objet JSON : {"sql": "...", "explanation": "..."}.
+L'explication décrit brièvement la requête, dans la langue de la question.`
+
+// NL2SQLAnswer est la requête proposée par le modèle.
+type NL2SQLAnswer struct {
+	SQL         string `json:"sql"`
+	Explanation string `json:"explanation"`
+}
+
+// FormatSchema décrit les tables sous la forme "table(colonne type, ...)".
+func FormatSchema(tables []models.Table) string {
+	var b strings.Builder
+	for _, t := range tables {
+		cols := make([]string, len(t.Columns))
+		for i, c := range t.Columns {
+			cols[i] = fmt.Sprintf("%q %s", c.ColumnName, c.DataType)
+			if c.IsNullable == "NO" {
+				cols[i] += " NOT NULL"
+			}
+		}
+		fmt.Fprintf(&b, "%q(%s)\n", t.TableName, strings.Join(cols, ", "))
+	}
+	return b.String()
+}
+
+// BuildNL2SQLPrompt construit la conversation demandant au modèle une requête
+// répondant à question sur le schéma donné.
+func BuildNL2SQLPrompt(question string, tables []models.Table) []ChatMessage {
+	return []ChatMessage{
+		{Role: "system", Content: nl2sqlSystemPrompt},
+		{Role: "user", Content: "Schéma :\n" + FormatSchema(tables) + "\nQuestion : " + question},
+	}
+}
+
+// ParseNL2SQLAnswer extrait l'objet JSON de la réponse du modèle, en tolérant
+// un bloc de code Markdown ou du texte autour.
+func ParseNL2SQLAnswer(content string) (NL2SQLAnswer, error) {
+	var answer NL2SQLAnswer
+	if err := decodeModelJSON(content, &answer); err != nil {
+		return answer, err
+	}
+	answer.SQL = strings.TrimSuffix(strings.TrimSpace(answer.SQL), ";")
+	if answer.SQL == "" {
+		return answer, fmt.Errorf("le modèle n'a pas proposé de requête")
+	}
+	return answer, nil
+}
+
+// decodeModelJSON décode le premier objet JSON d'une réponse de modèle.
+func decodeModelJSON(content string, out interface{}) error {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return fmt.Errorf("réponse du modèle sans objet JSON")
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), out); err != nil {
+		return fmt.Errorf("réponse du modèle illisible : %w", err)
+	}
+	return nil
+}
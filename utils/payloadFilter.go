@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/qdrant/go-client/qdrant"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FieldsPayloadKey est la clé du payload sous laquelle le vectoriseur copie
+// les colonnes choisies de la ligne source.
+const FieldsPayloadKey = "fields"
+
+// FilterExpr est le langage de filtre accepté par /ask :
+//
+//	{"must": [{"key": "categorie", "match": "Mobilier"},
+//	          {"key": "prix", "range": {"lt": 100}}],
+//	 "must_not": [{"key": "stock", "match": 0}]}
+//
+// Les clés désignent les colonnes copiées dans le payload ("fields.<col>"),
+// ainsi que "source" et "data_id".
+type FilterExpr struct {
+	Must    []FilterCondition `json:"must,omitempty"`
+	Should  []FilterCondition `json:"should,omitempty"`
+	MustNot []FilterCondition `json:"must_not,omitempty"`
+}
+
+// FilterCondition est soit une condition sur un champ (match, in, range ou
+// is_null), soit un sous-filtre (must / should / must_not).
+type FilterCondition struct {
+	Key    string        `json:"key,omitempty"`
+	Match  interface{}   `json:"match,omitempty"`
+	In     []interface{} `json:"in,omitempty"`
+	Range  *RangeExpr    `json:"range,omitempty"`
+	IsNull *bool         `json:"is_null,omitempty"`
+	FilterExpr
+}
+
+// RangeExpr accepte des bornes numériques ou des dates RFC 3339.
+type RangeExpr struct {
+	Gt  interface{} `json:"gt,omitempty"`
+	Gte interface{} `json:"gte,omitempty"`
+	Lt  interface{} `json:"lt,omitempty"`
+	Lte interface{} `json:"lte,omitempty"`
+}
+
+// FilteredField est un champ du payload utilisé par un filtre, avec le type
+// d'index Qdrant adapté.
+type FilteredField struct {
+	Name string
+	Type qdrant.FieldType
+}
+
+const (
+	maxFilterDepth      = 5
+	maxFilterConditions = 100
+)
+
+var filterKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type filterBuilder struct {
+	conditions int
+	fields     []FilteredField
+}
+
+// ToQdrant valide le filtre et le traduit en qdrant.Filter. Il retourne aussi
+// les champs filtrés pour créer leurs index.
+func (f *FilterExpr) ToQdrant() (*qdrant.Filter, []FilteredField, error) {
+	b := &filterBuilder{}
+	filter, err := b.filter(f, 1)
+	if err != nil {
+		return nil, nil, err
+	}
+	return filter, b.fields, nil
+}
+
+func (f *FilterExpr) empty() bool {
+	return len(f.Must) == 0 && len(f.Should) == 0 && len(f.MustNot) == 0
+}
+
+func (b *filterBuilder) filter(f *FilterExpr, depth int) (*qdrant.Filter, error) {
+	if depth > maxFilterDepth {
+		return nil, fmt.Errorf("filtre trop imbriqué (max %d niveaux)", maxFilterDepth)
+	}
+	if f.empty() {
+		return nil, fmt.Errorf("filtre vide : must, should ou must_not requis")
+	}
+
+	out := &qdrant.Filter{}
+	lists := []struct {
+		in  []FilterCondition
+		out *[]*qdrant.Condition
+	}{
+		{f.Must, &out.Must},
+		{f.Should, &out.Should},
+		{f.MustNot, &out.MustNot},
+	}
+	for _, l := range lists {
+		for _, c := range l.in {
+			cond, err := b.condition(c, depth)
+			if err != nil {
+				return nil, err
+			}
+			*l.out = append(*l.out, cond)
+		}
+	}
+	return out, nil
+}
+
+func (b *filterBuilder) condition(c FilterCondition, depth int) (*qdrant.Condition, error) {
+	b.conditions++
+	if b.conditions > maxFilterConditions {
+		return nil, fmt.Errorf("trop de conditions dans le filtre (max %d)", maxFilterConditions)
+	}
+
+	kinds := 0
+	for _, set := range []bool{c.Match != nil, c.In != nil, c.Range != nil, c.IsNull != nil, !c.FilterExpr.empty()} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("chaque condition doit avoir exactement un opérateur : match, in, range, is_null ou un sous-filtre")
+	}
+
+	// Sous-filtre imbriqué
+	if !c.FilterExpr.empty() {
+		if c.Key != "" {
+			return nil, fmt.Errorf("un sous-filtre ne prend pas de clé (%q)", c.Key)
+		}
+		sub, err := b.filter(&c.FilterExpr, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		return qdrant.NewFilterAsCondition(sub), nil
+	}
+
+	field, err := payloadField(c.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c.Match != nil:
+		switch v := c.Match.(type) {
+		case string:
+			b.addField(field, qdrant.FieldType_FieldTypeKeyword)
+			return qdrant.NewMatchKeyword(field, v), nil
+		case bool:
+			b.addField(field, qdrant.FieldType_FieldTypeBool)
+			return qdrant.NewMatchBool(field, v), nil
+		case float64:
+			return b.numberEquals(field, v), nil
+		default:
+			return nil, fmt.Errorf("match sur %q : type non supporté %T", c.Key, c.Match)
+		}
+
+	case c.In != nil:
+		if len(c.In) == 0 {
+			return nil, fmt.Errorf("in sur %q : liste vide", c.Key)
+		}
+		var keywords []string
+		var numbers []*qdrant.Condition
+		for _, item := range c.In {
+			switch v := item.(type) {
+			case string:
+				keywords = append(keywords, v)
+			case float64:
+				numbers = append(numbers, b.numberEquals(field, v))
+			default:
+				return nil, fmt.Errorf("in sur %q : type non supporté %T", c.Key, item)
+			}
+		}
+		if len(keywords) > 0 && len(numbers) > 0 {
+			return nil, fmt.Errorf("in sur %q : valeurs de types mélangés", c.Key)
+		}
+		if len(numbers) > 0 {
+			return qdrant.NewFilterAsCondition(&qdrant.Filter{Should: numbers}), nil
+		}
+		b.addField(field, qdrant.FieldType_FieldTypeKeyword)
+		return qdrant.NewMatchKeywords(field, keywords...), nil
+
+	case c.Range != nil:
+		return b.rangeCondition(field, c.Key, c.Range)
+
+	default:
+		if *c.IsNull {
+			return qdrant.NewIsNull(field), nil
+		}
+		return qdrant.NewFilterAsCondition(&qdrant.Filter{
+			MustNot: []*qdrant.Condition{qdrant.NewIsNull(field)},
+		}), nil
+	}
+}
+
+func (b *filterBuilder) rangeCondition(field, key string, r *RangeExpr) (*qdrant.Condition, error) {
+	bounds := []interface{}{r.Gt, r.Gte, r.Lt, r.Lte}
+	var numbers, dates int
+	for _, v := range bounds {
+		switch v.(type) {
+		case nil:
+		case float64:
+			numbers++
+		case string:
+			dates++
+		default:
+			return nil, fmt.Errorf("range sur %q : type non supporté %T", key, v)
+		}
+	}
+	if numbers+dates == 0 {
+		return nil, fmt.Errorf("range sur %q : au moins une borne gt, gte, lt ou lte requise", key)
+	}
+	if numbers > 0 && dates > 0 {
+		return nil, fmt.Errorf("range sur %q : bornes de types mélangés", key)
+	}
+
+	if numbers > 0 {
+		num := func(v interface{}) *float64 {
+			if f, ok := v.(float64); ok {
+				return &f
+			}
+			return nil
+		}
+		b.addField(field, qdrant.FieldType_FieldTypeFloat)
+		return qdrant.NewRange(field, &qdrant.Range{
+			Gt: num(r.Gt), Gte: num(r.Gte), Lt: num(r.Lt), Lte: num(r.Lte),
+		}), nil
+	}
+
+	var parseErr error
+	ts := func(v interface{}) *timestamppb.Timestamp {
+		s, ok := v.(string)
+		if !ok {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			parseErr = fmt.Errorf("range sur %q : date RFC 3339 invalide %q", key, s)
+			return nil
+		}
+		return timestamppb.New(t)
+	}
+	dr := &qdrant.DatetimeRange{Gt: ts(r.Gt), Gte: ts(r.Gte), Lt: ts(r.Lt), Lte: ts(r.Lte)}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	b.addField(field, qdrant.FieldType_FieldTypeDatetime)
+	return qdrant.NewDatetimeRange(field, dr), nil
+}
+
+// numberEquals teste l'égalité numérique par un range fermé [v, v] : un match
+// Qdrant ne porte que sur les entiers et ignorerait les colonnes NUMERIC ou
+// flottantes, stockées en nombres décimaux dans le payload.
+func (b *filterBuilder) numberEquals(field string, v float64) *qdrant.Condition {
+	b.addField(field, qdrant.FieldType_FieldTypeFloat)
+	return qdrant.NewRange(field, &qdrant.Range{Gte: &v, Lte: &v})
+}
+
+func (b *filterBuilder) addField(name string, fieldType qdrant.FieldType) {
+	// source et data_id sont déjà indexés à la création de la collection
+	if name == "source" || name == "data_id" {
+		return
+	}
+	for _, f := range b.fields {
+		if f.Name == name {
+			return
+		}
+	}
+	b.fields = append(b.fields, FilteredField{Name: name, Type: fieldType})
+}
+
+// payloadField traduit une clé du filtre en chemin dans le payload.
+func payloadField(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("clé manquante dans une condition du filtre")
+	}
+	if !filterKeyRe.MatchString(key) {
+		return "", fmt.Errorf("clé de filtre invalide : %q", key)
+	}
+	switch key {
+	case "owner_id":
+		return "", fmt.Errorf("le filtre ne peut pas porter sur owner_id")
+	case "source", "data_id":
+		return key, nil
+	default:
+		return FieldsPayloadKey + "." + key, nil
+	}
+}
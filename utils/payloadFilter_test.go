@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func decodeFilter(t *testing.T, raw string) *FilterExpr {
+	t.Helper()
+	var f FilterExpr
+	if err := json.Unmarshal([]byte(raw), &f); err != nil {
+		t.Fatal(err)
+	}
+	return &f
+}
+
+// nestedFilter imbrique levels filtres autour d'une condition simple.
+func nestedFilter(levels int) string {
+	raw := `{"key": "a", "match": "x"}`
+	for i := 1; i < levels; i++ {
+		raw = `{"must": [` + raw + `]}`
+	}
+	return `{"must": [` + raw + `]}`
+}
+
+// manyConditions retourne un filtre de n conditions match.
+func manyConditions(n int) string {
+	conds := make([]string, n)
+	for i := range conds {
+		conds[i] = fmt.Sprintf(`{"key": "c%d", "match": %d}`, i, i)
+	}
+	return `{"must": [` + strings.Join(conds, ",") + `]}`
+}
+
+func TestFilterExprToQdrant(t *testing.T) {
+	ptr := func(v float64) *float64 { return &v }
+	closed := func(v float64) *qdrant.Range { return &qdrant.Range{Gte: ptr(v), Lte: ptr(v)} }
+	sameRange := func(got, want *qdrant.Range) bool {
+		eq := func(a, b *float64) bool { return (a == nil) == (b == nil) && (a == nil || *a == *b) }
+		return got != nil && eq(got.Gt, want.Gt) && eq(got.Gte, want.Gte) && eq(got.Lt, want.Lt) && eq(got.Lte, want.Lte)
+	}
+
+	tests := []struct {
+		name   string
+		filter string
+		check  func(*qdrant.Filter) bool
+		fields []FilteredField
+	}{
+		{
+			"match texte",
+			`{"must": [{"key": "categorie", "match": "Mobilier"}]}`,
+			func(f *qdrant.Filter) bool {
+				c := f.Must[0].GetField()
+				return c.Key == "fields.categorie" && c.GetMatch().GetKeyword() == "Mobilier"
+			},
+			[]FilteredField{{"fields.categorie", qdrant.FieldType_FieldTypeKeyword}},
+		},
+		{
+			"match booléen",
+			`{"must_not": [{"key": "actif", "match": false}]}`,
+			func(f *qdrant.Filter) bool {
+				m := f.MustNot[0].GetField().GetMatch()
+				_, ok := m.GetMatchValue().(*qdrant.Match_Boolean)
+				return ok && !m.GetBoolean()
+			},
+			[]FilteredField{{"fields.actif", qdrant.FieldType_FieldTypeBool}},
+		},
+		{
+			// Un entier doit aussi trouver les valeurs NUMERIC stockées en décimal
+			"match entier",
+			`{"must": [{"key": "stock", "match": 0}]}`,
+			func(f *qdrant.Filter) bool { return sameRange(f.Must[0].GetField().GetRange(), closed(0)) },
+			[]FilteredField{{"fields.stock", qdrant.FieldType_FieldTypeFloat}},
+		},
+		{
+			"match décimal",
+			`{"must": [{"key": "prix", "match": 19.9}]}`,
+			func(f *qdrant.Filter) bool { return sameRange(f.Must[0].GetField().GetRange(), closed(19.9)) },
+			[]FilteredField{{"fields.prix", qdrant.FieldType_FieldTypeFloat}},
+		},
+		{
+			"in textes",
+			`{"must": [{"key": "source", "in": ["rh/employee", "rh/service"]}]}`,
+			func(f *qdrant.Filter) bool {
+				c := f.Must[0].GetField()
+				kw := c.GetMatch().GetKeywords().GetStrings()
+				return c.Key == "source" && len(kw) == 2 && kw[1] == "rh/service"
+			},
+			nil, // source est indexé à la création de la collection
+		},
+		{
+			"in nombres",
+			`{"should": [{"key": "note", "in": [1, 2.5]}]}`,
+			func(f *qdrant.Filter) bool {
+				alts := f.Should[0].GetFilter().GetShould()
+				return len(alts) == 2 && sameRange(alts[0].GetField().GetRange(), closed(1)) &&
+					sameRange(alts[1].GetField().GetRange(), closed(2.5))
+			},
+			[]FilteredField{{"fields.note", qdrant.FieldType_FieldTypeFloat}},
+		},
+		{
+			"range numérique",
+			`{"must": [{"key": "prix", "range": {"gte": 10, "lt": 100}}]}`,
+			func(f *qdrant.Filter) bool {
+				return sameRange(f.Must[0].GetField().GetRange(), &qdrant.Range{Gte: ptr(10), Lt: ptr(100)})
+			},
+			[]FilteredField{{"fields.prix", qdrant.FieldType_FieldTypeFloat}},
+		},
+		{
+			"range de dates",
+			`{"must": [{"key": "cree_le", "range": {"gt": "2024-01-01T00:00:00Z"}}]}`,
+			func(f *qdrant.Filter) bool {
+				dr := f.Must[0].GetField().GetDatetimeRange()
+				return dr.GetGt().AsTime().Year() == 2024 && dr.Lt == nil
+			},
+			[]FilteredField{{"fields.cree_le", qdrant.FieldType_FieldTypeDatetime}},
+		},
+		{
+			"is_null",
+			`{"must": [{"key": "fin", "is_null": true}]}`,
+			func(f *qdrant.Filter) bool { return f.Must[0].GetIsNull().GetKey() == "fields.fin" },
+			nil,
+		},
+		{
+			"is_null false",
+			`{"must": [{"key": "fin", "is_null": false}]}`,
+			func(f *qdrant.Filter) bool {
+				return f.Must[0].GetFilter().GetMustNot()[0].GetIsNull().GetKey() == "fields.fin"
+			},
+			nil,
+		},
+		{
+			"sous-filtre",
+			`{"must": [{"should": [{"key": "a", "match": "x"}, {"key": "b", "match": "y"}]}]}`,
+			func(f *qdrant.Filter) bool { return len(f.Must[0].GetFilter().GetShould()) == 2 },
+			[]FilteredField{{"fields.a", qdrant.FieldType_FieldTypeKeyword}, {"fields.b", qdrant.FieldType_FieldTypeKeyword}},
+		},
+		{
+			"profondeur maximale",
+			nestedFilter(maxFilterDepth),
+			func(f *qdrant.Filter) bool { return f.Must[0].GetFilter() != nil },
+			[]FilteredField{{"fields.a", qdrant.FieldType_FieldTypeKeyword}},
+		},
+		{
+			"nombre maximal de conditions",
+			manyConditions(maxFilterConditions),
+			func(f *qdrant.Filter) bool { return len(f.Must) == maxFilterConditions },
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, fields, err := decodeFilter(t, tt.filter).ToQdrant()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.check(filter) {
+				t.Errorf("filtre inattendu : %v", filter)
+			}
+			if tt.fields != nil && fmt.Sprint(fields) != fmt.Sprint(tt.fields) {
+				t.Errorf("champs %v, attendu %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestFilterExprToQdrantErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		msg    string
+	}{
+		{"trop imbriqué", nestedFilter(maxFilterDepth + 1), "trop imbriqué"},
+		{"trop de conditions", manyConditions(maxFilterConditions + 1), "trop de conditions"},
+		{"owner_id", `{"must": [{"key": "owner_id", "match": "autre"}]}`, "owner_id"},
+		{"owner_id imbriqué", `{"should": [{"must_not": [{"key": "owner_id", "in": ["a"]}]}]}`, "owner_id"},
+		{"filtre vide", `{}`, "filtre vide"},
+		{"sans opérateur", `{"must": [{"key": "a"}]}`, "exactement un opérateur"},
+		{"deux opérateurs", `{"must": [{"key": "a", "match": 1, "is_null": true}]}`, "exactement un opérateur"},
+		{"clé manquante", `{"must": [{"match": 1}]}`, "clé manquante"},
+		{"clé invalide", `{"must": [{"key": "a.b", "match": 1}]}`, "clé de filtre invalide"},
+		{"sous-filtre avec clé", `{"must": [{"key": "a", "must": [{"key": "b", "match": 1}]}]}`, "ne prend pas de clé"},
+		{"match objet", `{"must": [{"key": "a", "match": {"x": 1}}]}`, "type non supporté"},
+		{"in vide", `{"must": [{"key": "a", "in": []}]}`, "liste vide"},
+		{"in mélangé", `{"must": [{"key": "a", "in": ["x", 1]}]}`, "types mélangés"},
+		{"range vide", `{"must": [{"key": "a", "range": {}}]}`, "au moins une borne"},
+		{"range mélangé", `{"must": [{"key": "a", "range": {"gt": 1, "lt": "2024-01-01T00:00:00Z"}}]}`, "types mélangés"},
+		{"date invalide", `{"must": [{"key": "a", "range": {"gt": "hier"}}]}`, "RFC 3339"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := decodeFilter(t, tt.filter).ToQdrant()
+			if err == nil || !strings.Contains(err.Error(), tt.msg) {
+				t.Errorf("erreur contenant %q attendue, reçu %v", tt.msg, err)
+			}
+		})
+	}
+}
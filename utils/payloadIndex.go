@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+// indexedFields mémorise les champs du payload déjà indexés dans la collection.
+var indexedFields sync.Map
+
+// EnsurePayloadIndexes crée les index manquants pour les champs donnés. Un
+// champ déjà indexé (quel que soit son type) est laissé tel quel.
+func EnsurePayloadIndexes(fields []FilteredField) error {
+	var missing []FilteredField
+	for _, f := range fields {
+		if _, ok := indexedFields.Load(f.Name); !ok {
+			missing = append(missing, f)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	client, collection, err := getQdrantClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	info, err := client.GetCollectionInfo(ctx, collection)
+	if err != nil {
+		return fmt.Errorf("erreur lecture collection Qdrant : %w", err)
+	}
+	for name := range info.GetPayloadSchema() {
+		indexedFields.Store(name, struct{}{})
+	}
+
+	for _, f := range missing {
+		if _, ok := indexedFields.Load(f.Name); ok {
+			continue
+		}
+		_, err := client.CreateFieldIndex(ctx, &qdrant.CreateFieldIndexCollection{
+			CollectionName: collection,
+			FieldName:      f.Name,
+			FieldType:      f.Type.Enum(),
+		})
+		if err != nil {
+			return fmt.Errorf("erreur lors de l'indexation du champ %s : %w", f.Name, err)
+		}
+		indexedFields.Store(f.Name, struct{}{})
+	}
+	return nil
+}
+
+// PostgresFieldType choisit le type d'index Qdrant adapté à un type de
+// colonne PostgreSQL (tel que renvoyé par DatabaseTypeName).
+func PostgresFieldType(dbType string) qdrant.FieldType {
+	switch dbType {
+	case "INT2", "INT4", "INT8":
+		return qdrant.FieldType_FieldTypeInteger
+	case "NUMERIC", "FLOAT4", "FLOAT8":
+		return qdrant.FieldType_FieldTypeFloat
+	case "BOOL":
+		return qdrant.FieldType_FieldTypeBool
+	case "DATE", "TIMESTAMP", "TIMESTAMPTZ":
+		return qdrant.FieldType_FieldTypeDatetime
+	case "UUID":
+		return qdrant.FieldType_FieldTypeUuid
+	default:
+		return qdrant.FieldType_FieldTypeKeyword
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+var (
+	qdrantMu     sync.Mutex
+	qdrantClient *qdrant.Client
+)
+
+// getQdrantClient retourne un client Qdrant partagé et le nom de la collection.
+// Le client est créé au premier appel puis réutilisé.
+func getQdrantClient() (*qdrant.Client, string, error) {
+	collection := os.Getenv("QDRANT_COLLECTION")
+
+	qdrantMu.Lock()
+	defer qdrantMu.Unlock()
+
+	if qdrantClient != nil {
+		return qdrantClient, collection, nil
+	}
+
+	host := os.Getenv("QDRANT_HOST")
+	portStr := os.Getenv("QDRANT_PORT")
+	apiKey := os.Getenv("QDRANT_API_KEY")
+
+	if host == "" || portStr == "" || collection == "" {
+		return nil, "", fmt.Errorf("env QDRANT_HOST, QDRANT_PORT ou QDRANT_COLLECTION manquantes")
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, "", fmt.Errorf("QDRANT_PORT invalide : %w", err)
+	}
+
+	cfg := qdrant.Config{
+		Host:   host,
+		Port:   port,
+		APIKey: apiKey,
+		UseTLS: true,
+	}
+	client, err := qdrant.NewClient(&cfg)
+	if err != nil {
+		return nil, "", fmt.Errorf("erreur création client Qdrant : %w", err)
+	}
+
+	qdrantClient = client
+	return client, collection, nil
+}
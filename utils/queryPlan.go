@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// QueryPlan est le plan estimé d'une requête, tel que retourné par
+// EXPLAIN (FORMAT JSON), sans l'exécuter.
+type QueryPlan struct {
+	Plan          map[string]interface{} `json:"plan"`
+	StartupCost   float64                `json:"startup_cost"`
+	TotalCost     float64                `json:"total_cost"`
+	EstimatedRows int64                  `json:"estimated_rows"`
+	// MaxCost est le plafond appliqué (0 : aucun) et ExceedsMaxCost indique
+	// que la requête serait refusée.
+	MaxCost        float64 `json:"max_cost,omitempty"`
+	ExceedsMaxCost bool    `json:"exceeds_max_cost"`
+}
+
+// QueryCostError signale une requête refusée car son coût estimé dépasse
+// le plafond.
+type QueryCostError struct {
+	*QueryPlan
+}
+
+func (e *QueryCostError) Error() string {
+	return fmt.Sprintf("coût estimé %.2f supérieur au plafond %.2f", e.TotalCost, e.MaxCost)
+}
+
+// ExplainQuery retourne le plan estimé de query (EXPLAIN sans ANALYZE : la
+// requête n'est pas exécutée).
+func ExplainQuery(ctx context.Context, db queryer, query string, args ...interface{}) (*QueryPlan, error) {
+	rows, err := db.QueryContext(ctx, "EXPLAIN (FORMAT JSON) "+query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Erreur EXPLAIN: %w", err)
+	}
+	defer rows.Close()
+
+	var raw []byte
+	if rows.Next() {
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("Erreur lecture plan: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Erreur EXPLAIN: %w", err)
+	}
+	return parseExplain(raw)
+}
+
+// ExplainReadOnlyQuery retourne le plan estimé de query dans une transaction
+// en lecture seule bornée par limits. ExceedsMaxCost est renseigné d'après
+// limits.MaxCost.
+func ExplainReadOnlyQuery(ctx context.Context, db *sql.DB, query string, limits QueryLimits, args ...interface{}) (*QueryPlan, error) {
+	tx, err := beginReadOnly(ctx, db, limits)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	plan, err := ExplainQuery(ctx, tx, query, args...)
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	plan.MaxCost = limits.MaxCost
+	plan.ExceedsMaxCost = limits.MaxCost > 0 && plan.TotalCost > limits.MaxCost
+	return plan, nil
+}
+
+// parseExplain lit la sortie [{"Plan": {...}}] d'EXPLAIN (FORMAT JSON).
+func parseExplain(raw []byte) (*QueryPlan, error) {
+	var explain []struct {
+		Plan map[string]interface{} `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &explain); err != nil {
+		return nil, fmt.Errorf("plan EXPLAIN illisible : %w", err)
+	}
+	if len(explain) == 0 || explain[0].Plan == nil {
+		return nil, fmt.Errorf("plan EXPLAIN vide")
+	}
+
+	plan := &QueryPlan{Plan: explain[0].Plan}
+	plan.StartupCost, _ = plan.Plan["Startup Cost"].(float64)
+	plan.TotalCost, _ = plan.Plan["Total Cost"].(float64)
+	rows, _ := plan.Plan["Plan Rows"].(float64)
+	plan.EstimatedRows = int64(rows)
+	return plan, nil
+}
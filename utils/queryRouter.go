@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Chemins de réponse d'une question
+const (
+	RouteSearch = "search" // recherche sémantique sur les lignes vectorisées
+	RouteSQL    = "sql"    // requête SQL générée (agrégats, comptages...)
+)
+
+// Route est la décision du routeur et sa justification.
+type Route struct {
+	Route      string `json:"route"`
+	Reason     string `json:"reason"`
+	Classifier string `json:"classifier"` // rules ou llm
+}
+
+// wordRe reconnaît l'une des alternatives comme mot entier. \b ne connaît
+// que l'ASCII et échouerait sur « année » ou « écart ».
+func wordRe(alternatives string) *regexp.Regexp {
+	return regexp.MustCompile(`(?:^|[^\p{L}\p{N}])(?:` + alternatives + `)(?:$|[^\p{L}\p{N}])`)
+}
+
+// aggregateRules repère les formulations qui appellent un calcul sur
+// plusieurs lignes plutôt que la recherche de lignes proches.
+var aggregateRules = []struct {
+	re     *regexp.Regexp
+	reason string
+}{
+	{wordRe(`combien|how many|how much|nombre (de|d')|number of|count`), "comptage"},
+	{wordRe(`moyenne|moyen|average|avg|mean`), "moyenne"},
+	{wordRe(`somme|total|sum`), "somme"},
+	{wordRe(`maximum|minimum|max|min|le plus|la plus|les plus|le moins|la moins|highest|lowest|most|least|largest|smallest`), "extremum"},
+	{wordRe(`top \d+|les \d+ (premiers|premières|derniers|dernières)|classement|ranking`), "classement"},
+	{wordRe(`(par|per|by) (mois|année|an|jour|semaine|month|year|day|week|catégorie|category|pays|country|ville|city)`), "regroupement"},
+	{wordRe(`pourcentage|percentage|proportion|ratio|taux|rate`), "proportion"},
+	{wordRe(`médiane|median|écart|variance`), "statistique"},
+}
+
+// ClassifyQuestion choisit le chemin d'une question par heuristiques : les
+// questions d'agrégat vont vers SQL, les autres vers la recherche.
+func ClassifyQuestion(question string) Route {
+	q := strings.ToLower(question)
+	var reasons []string
+	for _, rule := range aggregateRules {
+		if rule.re.MatchString(q) {
+			reasons = append(reasons, rule.reason)
+		}
+	}
+	if len(reasons) > 0 {
+		return Route{Route: RouteSQL, Reason: "agrégat détecté : " + strings.Join(reasons, ", "), Classifier: "rules"}
+	}
+	return Route{Route: RouteSearch, Reason: "aucun agrégat détecté", Classifier: "rules"}
+}
+
+const routerSystemPrompt = `Tu choisis comment répondre à une question sur une base de données.
+- "sql" : la réponse demande un calcul sur plusieurs lignes (comptage, somme, moyenne, extremum, classement, regroupement) ou un filtre exact sur des colonnes.
+- "search" : la réponse se trouve dans une ou quelques lignes proches du sens de la question (description, personne, produit précis).
+Réponds uniquement avec un objet JSON : {"route": "sql" ou "search", "reason": "..."}.`
+
+// ClassifyQuestionLLM demande le chemin au modèle de langage.
+func ClassifyQuestionLLM(ctx context.Context, llm LLM, question string) (Route, error) {
+	content, err := llm.Chat(ctx, []ChatMessage{
+		{Role: "system", Content: routerSystemPrompt},
+		{Role: "user", Content: question},
+	}, ChatOptions{})
+	if err != nil {
+		return Route{}, err
+	}
+
+	var route Route
+	if err := decodeModelJSON(content, &route); err != nil {
+		return Route{}, err
+	}
+	if route.Route != RouteSQL && route.Route != RouteSearch {
+		return Route{}, fmt.Errorf("chemin inconnu proposé par le classifieur : %q", route.Route)
+	}
+	route.Classifier = "llm"
+	return route, nil
+}
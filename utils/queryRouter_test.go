@@ -0,0 +1,39 @@
+package utils
+
+import "testing"
+
+func TestClassifyQuestion(t *testing.T) {
+	tests := []struct {
+		question string
+		route    string
+		reason   string
+	}{
+		{"Combien d'employés travaillent à Lyon ?", RouteSQL, "agrégat détecté : comptage"},
+		{"COMBIEN DE COMMANDES EN MARS", RouteSQL, "agrégat détecté : comptage"},
+		{"Quel est le salaire moyen et le total des primes ?", RouteSQL, "agrégat détecté : moyenne, somme"},
+		{"Quel est le produit le plus cher ?", RouteSQL, "agrégat détecté : extremum"},
+		{"Les 5 premières ventes", RouteSQL, "agrégat détecté : classement"},
+		{"Chiffre d'affaires par année", RouteSQL, "agrégat détecté : regroupement"},
+		{"Ventes par catégorie", RouteSQL, "agrégat détecté : regroupement"},
+		{"Quel est le taux de retour ?", RouteSQL, "agrégat détecté : proportion"},
+		// Règles sur des mots accentués : \b échouerait avant « é »
+		{"Quelle est la médiane des âges ?", RouteSQL, "agrégat détecté : statistique"},
+		{"Quel est l'écart entre les salaires ?", RouteSQL, "agrégat détecté : statistique"},
+		{"How many orders per month?", RouteSQL, "agrégat détecté : comptage, regroupement"},
+
+		// Mots entiers seulement, y compris entourés de lettres accentuées
+		{"Qui a le compte client le plus ancien ?", RouteSQL, "agrégat détecté : extremum"},
+		{"Trouve le contrat totalement résilié", RouteSearch, "aucun agrégat détecté"},
+		{"Décris la configuration minimale", RouteSearch, "aucun agrégat détecté"},
+		{"Quelle est l'adresse de l'account manager ?", RouteSearch, "aucun agrégat détecté"},
+		{"Un écartement des rails", RouteSearch, "aucun agrégat détecté"},
+		{"Résumé de l'année écoulée", RouteSearch, "aucun agrégat détecté"},
+		{"Qui est Marie Dupont ?", RouteSearch, "aucun agrégat détecté"},
+	}
+	for _, tt := range tests {
+		got := ClassifyQuestion(tt.question)
+		if got.Route != tt.route || got.Reason != tt.reason || got.Classifier != "rules" {
+			t.Errorf("%q : %+v, attendu %s (%s)", tt.question, got, tt.route, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/lib/pq"
+	"github.com/lib/pq/oid"
+)
+
+// queryer est implémenté par *sql.DB et *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// QueryLimits borne l'exécution d'une requête en lecture seule.
+type QueryLimits struct {
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+	MaxRows          int
+	// MaxCost est le coût estimé (EXPLAIN) au-delà duquel la requête est
+	// refusée sans être exécutée ; 0 désactive le plafond.
+	MaxCost float64
+}
+
+const (
+	defaultStatementTimeout = 30 * time.Second
+	defaultLockTimeout      = 5 * time.Second
+	defaultMaxRows          = 10000
+)
+
+// envDuration lit une durée Go positive, au minimum 1 ms, ou retourne def.
+func envDuration(name string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(name)); err == nil && d > 0 {
+		return max(d, time.Millisecond)
+	}
+	return def
+}
+
+// timeoutMillis convertit un délai pour SET LOCAL, en millisecondes : un délai
+// positif inférieur à 1 ms donnerait 0, qui désactive le délai côté serveur.
+func timeoutMillis(d time.Duration) int64 {
+	if d > 0 && d < time.Millisecond {
+		return 1
+	}
+	return d.Milliseconds()
+}
+
+// DefaultQueryLimits lit SQL_STATEMENT_TIMEOUT et SQL_LOCK_TIMEOUT (durées
+// Go, ex. "30s"), SQL_MAX_ROWS, qui est aussi le plafond de max_rows, et
+// SQL_MAX_COST, le plafond de coût estimé (désactivé par défaut).
+func DefaultQueryLimits() QueryLimits {
+	limits := QueryLimits{
+		StatementTimeout: envDuration("SQL_STATEMENT_TIMEOUT", defaultStatementTimeout),
+		LockTimeout:      envDuration("SQL_LOCK_TIMEOUT", defaultLockTimeout),
+		MaxRows:          defaultMaxRows,
+	}
+	if n, err := strconv.Atoi(os.Getenv("SQL_MAX_ROWS")); err == nil && n > 0 {
+		limits.MaxRows = n
+	}
+	if c, err := strconv.ParseFloat(os.Getenv("SQL_MAX_COST"), 64); err == nil && c > 0 {
+		limits.MaxCost = c
+	}
+	return limits
+}
+
+// WithMaxRows applique le max_rows demandé, sans dépasser la limite configurée.
+func (l QueryLimits) WithMaxRows(maxRows int) QueryLimits {
+	if maxRows > 0 && maxRows < l.MaxRows {
+		l.MaxRows = maxRows
+	}
+	return l
+}
+
+// WithMaxCost applique le max_cost demandé, sans dépasser le plafond configuré.
+func (l QueryLimits) WithMaxCost(maxCost float64) QueryLimits {
+	if maxCost > 0 && (l.MaxCost == 0 || maxCost < l.MaxCost) {
+		l.MaxCost = maxCost
+	}
+	return l
+}
+
+// ColumnMeta décrit une colonne du résultat, dans l'ordre du SELECT.
+// Nullable vient de pg_attribute.attnotnull pour une colonne lue directement
+// dans une table (une jointure externe peut toutefois y produire des NULL) et
+// vaut null quand il ne peut pas être connu (expression, driver sans
+// description des lignes).
+type ColumnMeta struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	OID      uint32 `json:"oid"`
+	Nullable *bool  `json:"nullable"`
+}
+
+// RowWriter reçoit les colonnes puis chaque ligne au fil de la lecture.
+type RowWriter interface {
+	WriteColumns(columns []ColumnMeta) error
+	WriteRow(values []interface{}) error
+}
+
+// QuerySummary résume une requête lue en flux.
+type QuerySummary struct {
+	RowCount  int  `json:"row_count"`
+	Truncated bool `json:"truncated"`
+}
+
+// QueryResult est le résultat d'une requête, éventuellement tronqué à MaxRows.
+// Les valeurs de chaque ligne suivent l'ordre de Columns.
+type QueryResult struct {
+	Columns []ColumnMeta    `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	QuerySummary
+}
+
+// resultCollector est le RowWriter qui garde tout en mémoire.
+type resultCollector struct {
+	result QueryResult
+}
+
+func (c *resultCollector) WriteColumns(columns []ColumnMeta) error {
+	c.result.Columns = columns
+	return nil
+}
+
+func (c *resultCollector) WriteRow(values []interface{}) error {
+	c.result.Rows = append(c.result.Rows, values)
+	return nil
+}
+
+// ErrQueryTimeout signale une requête interrompue par statement_timeout ou
+// lock_timeout.
+var ErrQueryTimeout = errors.New("délai d'exécution dépassé")
+
+// ReadOnlyQuery exécute query comme StreamReadOnlyQuery et retourne toutes les
+// lignes lues.
+func ReadOnlyQuery(ctx context.Context, db *sql.DB, query string, limits QueryLimits, args ...interface{}) (*QueryResult, error) {
+	collector := &resultCollector{}
+	summary, err := StreamReadOnlyQuery(ctx, db, query, limits, collector, args...)
+	if err != nil {
+		return nil, err
+	}
+	if collector.result.Rows == nil {
+		collector.result.Rows = [][]interface{}{}
+	}
+	collector.result.QuerySummary = summary
+	return &collector.result, nil
+}
+
+// StreamReadOnlyQuery exécute query dans une transaction BEGIN READ ONLY avec
+// statement_timeout et lock_timeout, et transmet au plus limits.MaxRows lignes
+// à out au fil de la lecture. Si limits.MaxCost est défini, la requête passe
+// d'abord par EXPLAIN et est refusée (*QueryCostError) au-delà du plafond.
+// L'annulation de ctx (client déconnecté) interrompt la requête côté serveur.
+func StreamReadOnlyQuery(ctx context.Context, db *sql.DB, query string, limits QueryLimits, out RowWriter, args ...interface{}) (QuerySummary, error) {
+	// Connexion dédiée : la description des colonnes passe par le driver
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return QuerySummary{}, fmt.Errorf("Erreur connexion DB: %w", err)
+	}
+	defer conn.Close()
+
+	tx, err := beginReadOnly(ctx, conn, limits)
+	if err != nil {
+		return QuerySummary{}, err
+	}
+	// Lecture seule : rien à valider
+	defer tx.Rollback()
+
+	if limits.MaxCost > 0 {
+		plan, err := ExplainQuery(ctx, tx, query, args...)
+		if err != nil {
+			return QuerySummary{}, queryError(ctx, err)
+		}
+		if plan.TotalCost > limits.MaxCost {
+			plan.MaxCost, plan.ExceedsMaxCost = limits.MaxCost, true
+			return QuerySummary{}, &QueryCostError{QueryPlan: plan}
+		}
+	}
+
+	columns, err := describeColumns(ctx, conn, tx, query)
+	if err != nil {
+		return QuerySummary{}, queryError(ctx, err)
+	}
+	summary, err := streamRows(ctx, tx, query, limits.MaxRows, out, columns, args...)
+	if err != nil {
+		return summary, queryError(ctx, err)
+	}
+	return summary, nil
+}
+
+// txBeginner est implémenté par *sql.DB et *sql.Conn.
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// beginReadOnly ouvre une transaction en lecture seule bornée par limits.
+func beginReadOnly(ctx context.Context, db txBeginner, limits QueryLimits) (*sql.Tx, error) {
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("Erreur ouverture transaction: %w", err)
+	}
+
+	for _, setting := range []string{
+		fmt.Sprintf("SET LOCAL statement_timeout = %d", timeoutMillis(limits.StatementTimeout)),
+		fmt.Sprintf("SET LOCAL lock_timeout = %d", timeoutMillis(limits.LockTimeout)),
+	} {
+		if _, err := tx.ExecContext(ctx, setting); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("Erreur configuration transaction: %w", err)
+		}
+	}
+	return tx, nil
+}
+
+// queryError signale par ErrQueryTimeout les requêtes interrompues par
+// statement_timeout ou lock_timeout (et non par l'annulation de ctx).
+func queryError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && (pqErr.Code == "57014" || pqErr.Code == "55P03") {
+		return fmt.Errorf("%w : %s", ErrQueryTimeout, pqErr.Message)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "57014" || pgErr.Code == "55P03") {
+		return fmt.Errorf("%w : %s", ErrQueryTimeout, pgErr.Message)
+	}
+	return err
+}
+
+// StreamRows exécute query et transmet à out ses colonnes puis au plus
+// maxRows lignes (toutes si maxRows <= 0).
+func StreamRows(ctx context.Context, db queryer, query string, maxRows int, out RowWriter, args ...interface{}) (QuerySummary, error) {
+	return streamRows(ctx, db, query, maxRows, out, nil, args...)
+}
+
+// streamRows est StreamRows avec des colonnes déjà décrites ; si columns est
+// nil, elles sont déduites des types rapportés par le driver.
+func streamRows(ctx context.Context, db queryer, query string, maxRows int, out RowWriter, columns []ColumnMeta, args ...interface{}) (QuerySummary, error) {
+	var summary QuerySummary
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return summary, fmt.Errorf("Erreur exécution requête: %w", err)
+	}
+	defer rows.Close()
+
+	if columns == nil {
+		if columns, err = columnMetas(rows); err != nil {
+			return summary, fmt.Errorf("Erreur récupération colonnes: %w", err)
+		}
+	}
+	if err := out.WriteColumns(columns); err != nil {
+		return summary, err
+	}
+
+	for rows.Next() {
+		if maxRows > 0 && summary.RowCount >= maxRows {
+			summary.Truncated = true
+			break
+		}
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range values {
+			valuePtrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return summary, fmt.Errorf("Erreur scan ligne: %w", err)
+		}
+		for i, val := range values {
+			if b, ok := val.([]byte); ok {
+				values[i] = string(b) // convertit les []byte en string
+			}
+		}
+		if err := out.WriteRow(values); err != nil {
+			return summary, err
+		}
+		summary.RowCount++
+	}
+	if err := rows.Err(); err != nil {
+		return summary, fmt.Errorf("Erreur lecture lignes: %w", err)
+	}
+	return summary, nil
+}
+
+// typeOIDs associe les noms de type rapportés par lib/pq à leur OID.
+var typeOIDs = func() map[string]uint32 {
+	m := make(map[string]uint32, len(oid.TypeName))
+	for o, name := range oid.TypeName {
+		m[name] = uint32(o)
+	}
+	return m
+}()
+
+// columnMetas décrit les colonnes de rows d'après les types rapportés par le
+// driver, faute de description des lignes. Avec lib/pq, les types inconnus
+// (enums, domaines...) ont un nom vide et l'OID 0, et Nullable reste null.
+func columnMetas(rows *sql.Rows) ([]ColumnMeta, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]ColumnMeta, len(types))
+	for i, ct := range types {
+		name := ct.DatabaseTypeName()
+		columns[i] = ColumnMeta{Name: ct.Name(), Type: name, OID: typeOIDs[name]}
+		if nullable, ok := ct.Nullable(); ok {
+			columns[i].Nullable = &nullable
+		}
+	}
+	return columns, nil
+}
+
+// describeColumns décrit les colonnes de query à partir de la description des
+// lignes envoyée par le serveur (driver pgx) : OID du type, et table et numéro
+// de colonne d'origine, qui donnent la nullabilité dans pg_attribute. Les
+// types absents du registre de pgx (enums, domaines, extensions) sont nommés
+// d'après pg_type. Retourne nil avec un autre driver.
+func describeColumns(ctx context.Context, conn *sql.Conn, tx *sql.Tx, query string) ([]ColumnMeta, error) {
+	var columns []ColumnMeta
+	var origins []columnOrigin // table et numéro de colonne de chaque colonne
+	err := conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return nil
+		}
+		sd, err := c.Conn().PgConn().Prepare(ctx, "", query, nil)
+		if err != nil {
+			return fmt.Errorf("Erreur exécution requête: %w", err)
+		}
+		columns = make([]ColumnMeta, len(sd.Fields))
+		origins = make([]columnOrigin, len(sd.Fields))
+		for i, fd := range sd.Fields {
+			columns[i] = ColumnMeta{Name: fd.Name, OID: fd.DataTypeOID}
+			if dt, ok := c.Conn().TypeMap().TypeForOID(fd.DataTypeOID); ok {
+				columns[i].Type = strings.ToUpper(dt.Name)
+			}
+			origins[i] = columnOrigin{table: fd.TableOID, num: int64(fd.TableAttributeNumber)}
+		}
+		return nil
+	})
+	if err != nil || columns == nil {
+		return nil, err
+	}
+
+	var unknownTypes, tables []uint32
+	for i, col := range columns {
+		if col.Type == "" {
+			unknownTypes = append(unknownTypes, col.OID)
+		}
+		if origins[i].table != 0 {
+			tables = append(tables, origins[i].table)
+		}
+	}
+
+	if len(unknownTypes) > 0 {
+		names := make(map[uint32]string)
+		err := queryByOIDs(ctx, tx, "SELECT oid, upper(typname) FROM pg_type WHERE oid = ANY($1::oid[])", unknownTypes, func(rows *sql.Rows) error {
+			var o int64
+			var name string
+			if err := rows.Scan(&o, &name); err != nil {
+				return err
+			}
+			names[uint32(o)] = name
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Erreur lecture pg_type: %w", err)
+		}
+		for i := range columns {
+			if columns[i].Type == "" {
+				columns[i].Type = names[columns[i].OID]
+			}
+		}
+	}
+
+	if len(tables) > 0 {
+		notNull := make(map[columnOrigin]bool)
+		err := queryByOIDs(ctx, tx, "SELECT attrelid, attnum, attnotnull FROM pg_attribute WHERE attrelid = ANY($1::oid[]) AND attnum > 0", tables, func(rows *sql.Rows) error {
+			var rel, num int64
+			var nn bool
+			if err := rows.Scan(&rel, &num, &nn); err != nil {
+				return err
+			}
+			notNull[columnOrigin{uint32(rel), num}] = nn
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Erreur lecture pg_attribute: %w", err)
+		}
+		for i, origin := range origins {
+			if nn, ok := notNull[origin]; ok && origin.table != 0 {
+				nullable := !nn
+				columns[i].Nullable = &nullable
+			}
+		}
+	}
+	return columns, nil
+}
+
+// columnOrigin est la colonne de table d'où provient une colonne du résultat
+// (table 0 pour une expression).
+type columnOrigin struct {
+	table uint32
+	num   int64
+}
+
+// queryByOIDs exécute query, dont $1 reçoit la liste oids, et appelle scan
+// pour chaque ligne.
+func queryByOIDs(ctx context.Context, db queryer, query string, oids []uint32, scan func(*sql.Rows) error) error {
+	list := make([]string, len(oids))
+	for i, o := range oids {
+		list[i] = strconv.FormatUint(uint64(o), 10)
+	}
+	rows, err := db.QueryContext(ctx, query, "{"+strings.Join(list, ",")+"}")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
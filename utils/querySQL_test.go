@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// Un délai inférieur à 1 ms ne doit pas devenir 0, qui désactive le délai
+// côté serveur.
+func TestDefaultQueryLimitsSubMillisecond(t *testing.T) {
+	t.Setenv("SQL_STATEMENT_TIMEOUT", "500us")
+	t.Setenv("SQL_LOCK_TIMEOUT", "1ns")
+
+	limits := DefaultQueryLimits()
+	if limits.StatementTimeout != time.Millisecond || limits.LockTimeout != time.Millisecond {
+		t.Errorf("délais = %s / %s, 1ms attendu", limits.StatementTimeout, limits.LockTimeout)
+	}
+}
+
+func TestTimeoutMillis(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want int64
+	}{
+		{0, 0},
+		{time.Nanosecond, 1},
+		{999 * time.Microsecond, 1},
+		{1500 * time.Microsecond, 1},
+		{30 * time.Second, 30000},
+	}
+	for _, tt := range tests {
+		if got := timeoutMillis(tt.d); got != tt.want {
+			t.Errorf("timeoutMillis(%s) = %d, attendu %d", tt.d, got, tt.want)
+		}
+	}
+}
+
+// Les métadonnées viennent de la description des lignes : OID réel, nom des
+// types inconnus de pgx lu dans pg_type, nullabilité lue dans pg_attribute.
+func TestReadOnlyQueryColumnMetadata(t *testing.T) {
+	const table, moodOID = 16400, 16500
+	db, queries := startFakePG(t, func(query string) *fakeResult {
+		text := func(name string) pgproto3.FieldDescription { return fakePGField(name, 25, 0, 0) }
+		switch {
+		case strings.Contains(query, "FROM pg_type"):
+			return &fakeResult{fields: []pgproto3.FieldDescription{text("oid"), text("typname")}, rows: [][]string{{"16500", "MOOD"}}}
+		case strings.Contains(query, "FROM pg_attribute"):
+			return &fakeResult{
+				fields: []pgproto3.FieldDescription{text("attrelid"), text("attnum"), text("attnotnull")},
+				rows:   [][]string{{"16400", "1", "t"}, {"16400", "2", "f"}, {"16400", "3", "t"}},
+			}
+		case strings.Contains(query, "FROM people"):
+			return &fakeResult{fields: []pgproto3.FieldDescription{
+				fakePGField("id", 23, table, 1),
+				fakePGField("label", 25, table, 2),
+				fakePGField("mood", moodOID, table, 3),
+				fakePGField("n", 23, 0, 0),
+			}}
+		}
+		return nil
+	})
+
+	result, err := ReadOnlyQuery(context.Background(), db, "SELECT id, label, mood, 1 + 1 AS n FROM people", DefaultQueryLimits())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notNull, nullable := false, true
+	want := []ColumnMeta{
+		{Name: "id", Type: "INT4", OID: 23, Nullable: &notNull},
+		{Name: "label", Type: "TEXT", OID: 25, Nullable: &nullable},
+		{Name: "mood", Type: "MOOD", OID: moodOID, Nullable: &notNull},
+		{Name: "n", Type: "INT4", OID: 23},
+	}
+	if len(result.Columns) != len(want) {
+		t.Fatalf("colonnes = %+v", result.Columns)
+	}
+	for i, col := range result.Columns {
+		w := want[i]
+		if col.Name != w.Name || col.Type != w.Type || col.OID != w.OID || (col.Nullable == nil) != (w.Nullable == nil) ||
+			(col.Nullable != nil && *col.Nullable != *w.Nullable) {
+			t.Errorf("colonne %d = %+v (nullable %v), attendu %+v (nullable %v)", i, col, deref(col.Nullable), w, deref(w.Nullable))
+		}
+	}
+
+	all := strings.ToLower(strings.Join(queries(), "\n"))
+	if !strings.Contains(all, "read only") || !strings.Contains(all, "statement_timeout") {
+		t.Errorf("transaction en lecture seule bornée attendue :\n%s", all)
+	}
+}
+
+func deref(b *bool) interface{} {
+	if b == nil {
+		return nil
+	}
+	return *b
+}
+
+func TestQueryErrorTimeout(t *testing.T) {
+	err := queryError(context.Background(), &pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"})
+	if !errors.Is(err, ErrQueryTimeout) {
+		t.Errorf("ErrQueryTimeout attendue, reçu %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := queryError(ctx, &pgconn.PgError{Code: "57014"}); errors.Is(err, ErrQueryTimeout) {
+		t.Error("une annulation du client n'est pas un dépassement de délai")
+	}
+}
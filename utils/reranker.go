@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Reranker attribue à chaque texte un score de pertinence pour la requête.
+// Les scores retournés sont dans l'ordre des textes reçus.
+type Reranker interface {
+	Rerank(query string, texts []string) ([]float32, error)
+	Name() string
+}
+
+var (
+	rerankerMu      sync.RWMutex
+	currentReranker Reranker
+)
+
+// SetReranker remplace le reranker utilisé par le service (utile pour les tests).
+func SetReranker(r Reranker) {
+	rerankerMu.Lock()
+	defer rerankerMu.Unlock()
+	currentReranker = r
+}
+
+// GetReranker retourne le reranker configuré, en le construisant depuis
+// l'environnement au premier appel.
+func GetReranker() (Reranker, error) {
+	rerankerMu.RLock()
+	r := currentReranker
+	rerankerMu.RUnlock()
+	if r != nil {
+		return r, nil
+	}
+
+	rerankerMu.Lock()
+	defer rerankerMu.Unlock()
+	if currentReranker != nil {
+		return currentReranker, nil
+	}
+	r, err := NewRerankerFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	currentReranker = r
+	return r, nil
+}
+
+// NewRerankerFromEnv construit le reranker à partir des variables :
+// RERANKER_PROVIDER (lexical par défaut, ou tei), RERANKER_URL et
+// RERANKER_API_KEY.
+func NewRerankerFromEnv() (Reranker, error) {
+	provider := strings.ToLower(os.Getenv("RERANKER_PROVIDER"))
+	url := os.Getenv("RERANKER_URL")
+	apiKey := os.Getenv("RERANKER_API_KEY")
+
+	switch provider {
+	case "", "lexical":
+		return LexicalReranker{}, nil
+	case "tei":
+		if url == "" {
+			return nil, fmt.Errorf("RERANKER_URL requis pour le fournisseur tei")
+		}
+		return &TEIReranker{URL: url, APIKey: apiKey}, nil
+	default:
+		return nil, fmt.Errorf("RERANKER_PROVIDER inconnu : %q", provider)
+	}
+}
+
+// --- HuggingFace text-embeddings-inference (/rerank) ---
+
+// TEIReranker appelle l'endpoint /rerank d'un cross-encoder servi par
+// text-embeddings-inference.
+type TEIReranker struct {
+	URL    string
+	APIKey string
+}
+
+type teiRerankRequest struct {
+	Query    string   `json:"query"`
+	Texts    []string `json:"texts"`
+	Truncate bool     `json:"truncate"`
+}
+
+type teiRerankResponse []struct {
+	Index int     `json:"index"`
+	Score float32 `json:"score"`
+}
+
+func (r *TEIReranker) Rerank(query string, texts []string) ([]float32, error) {
+	var result teiRerankResponse
+	payload := teiRerankRequest{Query: query, Texts: texts, Truncate: true}
+	if err := postJSONWith(embedderHTTPClient, r.URL, r.APIKey, payload, &result); err != nil {
+		return nil, fmt.Errorf("reranker : %w", err)
+	}
+
+	// La réponse est triée par score : on replace chaque score à son index
+	scores := make([]float32, len(texts))
+	seen := make([]bool, len(texts))
+	for _, s := range result {
+		if s.Index < 0 || s.Index >= len(texts) {
+			return nil, fmt.Errorf("index de rerank hors limites : %d", s.Index)
+		}
+		scores[s.Index] = s.Score
+		seen[s.Index] = true
+	}
+	for i, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("le reranker n'a pas noté le texte %d", i)
+		}
+	}
+	return scores, nil
+}
+
+func (r *TEIReranker) Name() string { return "tei" }
+
+// --- Recouvrement lexical ---
+
+// LexicalReranker note chaque texte par la part des termes de la requête
+// qu'il contient, avec un bonus pour les paires de termes consécutifs. Il ne
+// dépend d'aucun service externe.
+type LexicalReranker struct{}
+
+func (LexicalReranker) Rerank(query string, texts []string) ([]float32, error) {
+	queryTerms := uniqueTerms(tokenize(query))
+	queryPairs := termPairs(tokenize(query))
+
+	scores := make([]float32, len(texts))
+	if len(queryTerms) == 0 {
+		return scores, nil
+	}
+	for i, text := range texts {
+		terms := tokenize(text)
+		docTerms := make(map[string]bool, len(terms))
+		for _, t := range terms {
+			docTerms[t] = true
+		}
+		docPairs := make(map[string]bool)
+		for _, p := range termPairs(terms) {
+			docPairs[p] = true
+		}
+
+		var matched, pairs float32
+		for _, t := range queryTerms {
+			if docTerms[t] {
+				matched++
+			}
+		}
+		for _, p := range queryPairs {
+			if docPairs[p] {
+				pairs++
+			}
+		}
+
+		score := matched / float32(len(queryTerms))
+		if len(queryPairs) > 0 {
+			score = 0.8*score + 0.2*pairs/float32(len(queryPairs))
+		}
+		scores[i] = score
+	}
+	return scores, nil
+}
+
+func (LexicalReranker) Name() string { return "lexical" }
+
+func uniqueTerms(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	var unique []string
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+func termPairs(terms []string) []string {
+	var pairs []string
+	for i := 1; i < len(terms); i++ {
+		pairs = append(pairs, terms[i-1]+" "+terms[i])
+	}
+	return pairs
+}
+
+// RerankResults note les résultats avec le reranker puis les trie par score
+// de rerank décroissant. Score prend la valeur du score de rerank ;
+// VectorScore conserve le score de la recherche vectorielle.
+func RerankResults(reranker Reranker, query string, results []SearchResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	texts := make([]string, len(results))
+	for i, res := range results {
+		text, _ := res.Payload["text"].(string)
+		texts[i] = text
+	}
+
+	scores, err := reranker.Rerank(query, texts)
+	if err != nil {
+		return err
+	}
+	if len(scores) != len(results) {
+		return fmt.Errorf("le reranker a renvoyé %d scores pour %d textes", len(scores), len(results))
+	}
+
+	for i := range results {
+		score := scores[i]
+		results[i].RerankScore = &score
+		results[i].Score = score
+	}
+	sort.SliceStable(results, func(i, k int) bool { return results[i].Score > results[k].Score })
+	return nil
+}
+
+// searchCandidates récupère au moins candidates résultats (et au moins
+// offset + TopK) sans pagination, en ajoutant le texte au payload si besoin.
+// Le booléen indique que le texte devra être retiré des résultats.
+func searchCandidates(opts SearchOptions, candidates int, needText bool) ([]SearchResult, bool, error) {
+	window := opts
+	window.Offset = 0
+	window.TopK = candidates
+	if window.TopK < opts.Offset+opts.TopK {
+		window.TopK = opts.Offset + opts.TopK
+	}
+	stripText := needText && len(opts.WithPayload) > 0 && !slices.Contains(opts.WithPayload, "text")
+	if stripText {
+		window.WithPayload = append(slices.Clone(opts.WithPayload), "text")
+	}
+
+	results, err := SearchQdrant(window)
+	return results, stripText, err
+}
+
+// SearchQdrantReranked récupère candidates résultats (au moins offset + TopK),
+// les réordonne avec le reranker puis applique offset et TopK.
+func SearchQdrantReranked(opts SearchOptions, reranker Reranker, query string, candidates int) ([]SearchResult, error) {
+	// Le reranker a besoin du texte même si l'appelant ne l'a pas demandé
+	results, stripText, err := searchCandidates(opts, candidates, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := RerankResults(reranker, query, results); err != nil {
+		return nil, err
+	}
+	if stripText {
+		for _, res := range results {
+			delete(res.Payload, "text")
+		}
+	}
+	return pageResults(results, opts.Offset, opts.TopK), nil
+}
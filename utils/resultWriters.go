@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResultFormat est un format de sortie des résultats SQL.
+type ResultFormat string
+
+const (
+	FormatJSON   ResultFormat = "json"
+	FormatNDJSON ResultFormat = "ndjson"
+	FormatCSV    ResultFormat = "csv"
+	FormatArrow  ResultFormat = "arrow"
+)
+
+// formatMediaTypes associe chaque type MIME accepté à son format.
+var formatMediaTypes = map[string]ResultFormat{
+	"application/json":                    FormatJSON,
+	"application/x-ndjson":                FormatNDJSON,
+	"application/ndjson":                  FormatNDJSON,
+	"text/csv":                            FormatCSV,
+	"application/vnd.apache.arrow.stream": FormatArrow,
+}
+
+// ContentType retourne le type MIME de la réponse.
+func (f ResultFormat) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatArrow:
+		return "application/vnd.apache.arrow.stream"
+	}
+	return "application/json"
+}
+
+// ParseResultFormat valide un nom de format (json, ndjson, csv, arrow).
+func ParseResultFormat(name string) (ResultFormat, error) {
+	switch f := ResultFormat(strings.ToLower(strings.TrimSpace(name))); f {
+	case FormatJSON, FormatNDJSON, FormatCSV, FormatArrow:
+		return f, nil
+	}
+	return "", fmt.Errorf("format inconnu : %q (json, ndjson, csv ou arrow)", name)
+}
+
+// NegotiateResultFormat choisit le format d'après l'en-tête Accept, par
+// qualité décroissante. Un en-tête vide ou */* donne du JSON ; false si
+// aucun type accepté n'est supporté.
+func NegotiateResultFormat(accept string) (ResultFormat, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return FormatJSON, true
+	}
+
+	type candidate struct {
+		mediaType string
+		q         float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{mediaType, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, k int) bool { return candidates[i].q > candidates[k].q })
+
+	for _, c := range candidates {
+		if f, ok := formatMediaTypes[c.mediaType]; ok {
+			return f, true
+		}
+		if c.mediaType == "*/*" || c.mediaType == "application/*" {
+			return FormatJSON, true
+		}
+	}
+	return "", false
+}
+
+// ResultWriter écrit un résultat SQL en flux. Close termine la sortie avec le
+// résumé, et l'erreur survenue pendant la lecture s'il y en a une.
+type ResultWriter interface {
+	RowWriter
+	Close(summary QuerySummary, queryErr error) error
+}
+
+// NewResultWriter retourne le ResultWriter du format demandé.
+func NewResultWriter(format ResultFormat, w io.Writer) ResultWriter {
+	switch format {
+	case FormatNDJSON:
+		return &ndjsonResultWriter{enc: json.NewEncoder(w)}
+	case FormatCSV:
+		return &csvResultWriter{w: csv.NewWriter(w)}
+	case FormatArrow:
+		return newArrowResultWriter(w)
+	}
+	return &jsonResultWriter{w: bufio.NewWriter(w)}
+}
+
+// --- JSON : {"columns": [...], "rows": [[...], ...], "row_count": n, "truncated": b} ---
+
+type jsonResultWriter struct {
+	w    *bufio.Writer
+	rows int
+}
+
+func (j *jsonResultWriter) WriteColumns(columns []ColumnMeta) error {
+	b, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+	j.w.WriteString(`{"columns":`)
+	j.w.Write(b)
+	_, err = j.w.WriteString(`,"rows":[`)
+	return err
+}
+
+func (j *jsonResultWriter) WriteRow(values []interface{}) error {
+	b, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	if j.rows > 0 {
+		j.w.WriteByte(',')
+	}
+	j.rows++
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonResultWriter) Close(summary QuerySummary, queryErr error) error {
+	trailer := struct {
+		QuerySummary
+		Error string `json:"error,omitempty"`
+	}{QuerySummary: summary}
+	if queryErr != nil {
+		trailer.Error = queryErr.Error()
+	}
+	b, err := json.Marshal(trailer)
+	if err != nil {
+		return err
+	}
+	// Le résumé complète l'objet ouvert par WriteColumns
+	j.w.WriteString("],")
+	j.w.Write(b[1:])
+	j.w.WriteByte('\n')
+	return j.w.Flush()
+}
+
+// --- NDJSON : une ligne de colonnes, une ligne par tableau de valeurs, puis le résumé ---
+
+type ndjsonResultWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonResultWriter) WriteColumns(columns []ColumnMeta) error {
+	return n.enc.Encode(map[string]interface{}{"columns": columns})
+}
+
+func (n *ndjsonResultWriter) WriteRow(values []interface{}) error {
+	return n.enc.Encode(values)
+}
+
+func (n *ndjsonResultWriter) Close(summary QuerySummary, queryErr error) error {
+	trailer := struct {
+		QuerySummary
+		Error string `json:"error,omitempty"`
+	}{QuerySummary: summary}
+	if queryErr != nil {
+		trailer.Error = queryErr.Error()
+	}
+	return n.enc.Encode(trailer)
+}
+
+// --- CSV : ligne d'en-tête puis une ligne par résultat ; le résumé part dans
+// les trailers HTTP, et dans les en-têtes si le résultat tient dans le tampon
+// du writer. Un client qui ne lit pas les trailers et doit savoir si un gros
+// résultat a été tronqué utilise le format ndjson ou json. ---
+
+type csvResultWriter struct {
+	w       *csv.Writer
+	columns []ColumnMeta
+	record  []string
+}
+
+func (c *csvResultWriter) WriteColumns(columns []ColumnMeta) error {
+	c.columns = columns
+	c.record = make([]string, len(columns))
+	for i, col := range columns {
+		c.record[i] = col.Name
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvResultWriter) WriteRow(values []interface{}) error {
+	for i, v := range values {
+		c.record[i] = formatCSVValue(v, c.columns[i].Type)
+	}
+	return c.w.Write(c.record)
+}
+
+func (c *csvResultWriter) Close(QuerySummary, error) error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatCSVValue écrit NULL comme un champ vide et les dates sans heure.
+func formatCSVValue(v interface{}, typ string) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case time.Time:
+		if typ == "DATE" {
+			return val.Format("2006-01-02")
+		}
+		return val.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'g', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+)
+
+// schemaQuery liste les colonnes des tables du schéma public.
+const schemaQuery = `
+	SELECT
+		c.table_name,
+		c.column_name,
+		c.data_type,
+		c.is_nullable
+	FROM
+		information_schema.columns c
+	JOIN
+		information_schema.tables t
+	ON
+		c.table_name = t.table_name
+	WHERE
+		t.table_schema = 'public'
+		AND t.table_type = 'BASE TABLE'
+	ORDER BY
+		c.table_name, c.ordinal_position;
+	`
+
+// LoadSchema retourne les tables du schéma public et leurs colonnes, triées
+// par nom de table.
+func LoadSchema(ctx context.Context, db *sql.DB) ([]models.Table, error) {
+	rows, err := db.QueryContext(ctx, schemaQuery)
+	if err != nil {
+		return nil, fmt.Errorf("Erreur requête : %w", err)
+	}
+	defer rows.Close()
+
+	var tables []models.Table
+	index := make(map[string]int)
+	for rows.Next() {
+		var tableName, columnName, dataType, isNullable string
+		if err := rows.Scan(&tableName, &columnName, &dataType, &isNullable); err != nil {
+			return nil, fmt.Errorf("Erreur scan : %w", err)
+		}
+		i, ok := index[tableName]
+		if !ok {
+			i = len(tables)
+			index[tableName] = i
+			tables = append(tables, models.Table{TableName: tableName})
+		}
+		tables[i].Columns = append(tables[i].Columns, models.Column{
+			ColumnName: columnName,
+			DataType:   dataType,
+			IsNullable: isNullable,
+		})
+	}
+	return tables, rows.Err()
+}
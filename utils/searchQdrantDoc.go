@@ -3,8 +3,8 @@ package utils
 import (
 	"context"
 	"fmt"
-	"os"
-	"strconv"
+	"log"
+	"sort"
 
 	"github.com/qdrant/go-client/qdrant"
 )
@@ -13,6 +13,21 @@ type SearchResult struct {
 	ID      interface{}
 	Score   float32
 	Payload map[string]interface{}
+
+	// VectorScore est le score de la recherche vectorielle ; RerankScore n'est
+	// renseigné que si les résultats ont été réordonnés par un reranker.
+	VectorScore float32
+	RerankScore *float32 `json:",omitempty"`
+
+	// Vector est le vecteur dense du point, chargé seulement si
+	// SearchOptions.WithVectors est vrai.
+	Vector []float32 `json:"-"`
+
+	// Row est la ligne source relue dans PostgreSQL si la réhydratation est
+	// demandée ; RowStatus vaut alors found, missing ou unavailable.
+	Row       map[string]interface{} `json:",omitempty"`
+	RowStatus string                 `json:",omitempty"`
+	RowError  string                 `json:",omitempty"`
 }
 
 func convertPayload(payload map[string]*qdrant.Value) map[string]interface{} {
@@ -42,42 +57,171 @@ func convertPayload(payload map[string]*qdrant.Value) map[string]interface{} {
 	return result
 }
 
-func SearchQdrant(queryVector []float32, topK int) ([]SearchResult, error) {
-	host := os.Getenv("QDRANT_HOST")
-	portStr := os.Getenv("QDRANT_PORT")
-	apiKey := os.Getenv("QDRANT_API_KEY")
-	collection := os.Getenv("QDRANT_COLLECTION")
+// SearchOptions décrit une recherche sémantique. OwnerID est obligatoire :
+// un utilisateur ne voit jamais les points d'un autre propriétaire.
+type SearchOptions struct {
+	Vector  []float32
+	TopK    int
+	OwnerID string
+	Sources []string // optionnel, restreint aux sources "dbname/table"
+	DataIDs []string // optionnel, restreint à certaines lignes
+	Filter  *FilterExpr
+
+	ScoreThreshold *float32 // optionnel, score minimal (liste dense seulement en mode hybrid)
+	Offset         int      // pagination : nombre de résultats à sauter
+	WithPayload    []string // optionnel, champs du payload à renvoyer
+	GroupBy        string   // optionnel, champ de regroupement (data_id, source...)
+	GroupSize      int      // nombre de hits par groupe, défaut 1
+
+	Mode      string // dense (défaut), sparse ou hybrid
+	QueryText string // texte de la requête, pour le vecteur creux
+
+	WithVectors bool // charge le vecteur dense de chaque résultat (MMR)
+}
 
-	if host == "" || portStr == "" || collection == "" {
-		return nil, fmt.Errorf("QDRANT_HOST, QDRANT_PORT ou QDRANT_COLLECTION non définis")
+// hybridMinCandidates est le nombre minimal de candidats par liste avant fusion.
+const hybridMinCandidates = 20
+
+// SearchGroup regroupe les hits partageant la même valeur de GroupBy.
+type SearchGroup struct {
+	Key  interface{}    `json:"key"`
+	Hits []SearchResult `json:"hits"`
+}
+
+func withPayloadSelector(fields []string) *qdrant.WithPayloadSelector {
+	if len(fields) > 0 {
+		return qdrant.NewWithPayloadInclude(fields...)
 	}
+	return &qdrant.WithPayloadSelector{
+		SelectorOptions: &qdrant.WithPayloadSelector_Enable{
+			Enable: true,
+		},
+	}
+}
 
-	port, err := strconv.Atoi(portStr)
-	if err != nil {
-		return nil, fmt.Errorf("QDRANT_PORT invalide : %w", err)
+func toSearchResult(point *qdrant.ScoredPoint) SearchResult {
+	return SearchResult{
+		ID:          point.Id,
+		Score:       point.Score,
+		Payload:     convertPayload(point.Payload),
+		VectorScore: point.Score,
+		Vector:      denseVector(point.GetVectors()),
 	}
+}
 
-	cfg := qdrant.Config{
-		Host:   host,
-		Port:   port,
-		APIKey: apiKey,
-		UseTLS: true,
+// denseVector extrait le vecteur dense sans nom d'un point, qu'il soit renvoyé
+// seul ou parmi des vecteurs nommés (collection avec vecteur creux).
+func denseVector(vectors *qdrant.VectorsOutput) []float32 {
+	if vectors == nil {
+		return nil
+	}
+	v := vectors.GetVector()
+	if v == nil {
+		v = vectors.GetVectors().GetVectors()[""]
 	}
+	if dense := v.GetDense().GetData(); len(dense) > 0 {
+		return dense
+	}
+	return v.GetData()
+}
 
-	client, err := qdrant.NewClient(&cfg)
-	if err != nil {
-		return nil, fmt.Errorf("erreur création client Qdrant : %w", err)
+// pageResults applique offset et topK à une liste déjà triée.
+func pageResults(results []SearchResult, offset, topK int) []SearchResult {
+	if offset >= len(results) {
+		return []SearchResult{}
+	}
+	results = results[offset:]
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results
+}
+
+// GroupByField valide un champ de regroupement et retourne son chemin dans
+// le payload.
+func GroupByField(key string) (string, error) {
+	return payloadField(key)
+}
+
+// buildSearchFilter traduit les options en filtre Qdrant : owner_id, source et
+// data_id, plus le filtre libre de l'utilisateur.
+func buildSearchFilter(opts SearchOptions) (*qdrant.Filter, error) {
+	if opts.OwnerID == "" {
+		return nil, fmt.Errorf("owner_id requis pour la recherche")
 	}
 
+	filter := &qdrant.Filter{
+		Must: []*qdrant.Condition{
+			qdrant.NewMatchKeyword("owner_id", opts.OwnerID),
+		},
+	}
+	if len(opts.Sources) > 0 {
+		filter.Must = append(filter.Must, qdrant.NewMatchKeywords("source", opts.Sources...))
+	}
+	if len(opts.DataIDs) > 0 {
+		filter.Must = append(filter.Must, qdrant.NewMatchKeywords("data_id", opts.DataIDs...))
+	}
+	if opts.Filter != nil {
+		userFilter, fields, err := opts.Filter.ToQdrant()
+		if err != nil {
+			return nil, err
+		}
+		// Un index manquant ralentit la recherche sans la fausser
+		if err := EnsurePayloadIndexes(fields); err != nil {
+			log.Printf("indexation des champs filtrés : %v", err)
+		}
+		filter.Must = append(filter.Must, qdrant.NewFilterAsCondition(userFilter))
+	}
+	return filter, nil
+}
+
+// Modes de recherche
+const (
+	SearchDense  = "dense"
+	SearchSparse = "sparse"
+	SearchHybrid = "hybrid"
+)
+
+// rrfK est la constante de la fusion Reciprocal Rank Fusion.
+const rrfK = 60
+
+// ValidateSearchMode vérifie le mode demandé et la présence du vecteur creux.
+func ValidateSearchMode(mode string) error {
+	switch mode {
+	case "", SearchDense:
+		return nil
+	case SearchSparse, SearchHybrid:
+		if SparseVectorName() == "" {
+			return fmt.Errorf("la collection n'a pas de vecteur creux : mode %q indisponible", mode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("mode de recherche inconnu : %q (dense, sparse ou hybrid)", mode)
+	}
+}
+
+// searchLeg lance une recherche Qdrant, dense si sparse est nil, creuse sinon.
+func searchLeg(client *qdrant.Client, collection string, filter *qdrant.Filter, opts SearchOptions, sparse *SparseVector, limit, offset int) ([]SearchResult, error) {
 	searchParams := &qdrant.SearchPoints{
 		CollectionName: collection,
-		Vector:         queryVector,
-		Limit:          uint64(topK),
-		WithPayload: &qdrant.WithPayloadSelector{
-			SelectorOptions: &qdrant.WithPayloadSelector_Enable{
-				Enable: true,
-			},
-		},
+		Vector:         opts.Vector,
+		Filter:         filter,
+		Limit:          uint64(limit),
+		WithPayload:    withPayloadSelector(opts.WithPayload),
+		ScoreThreshold: opts.ScoreThreshold,
+	}
+	if opts.WithVectors {
+		searchParams.WithVectors = qdrant.NewWithVectorsEnable(true)
+	}
+	if sparse != nil {
+		name := SparseVectorName()
+		searchParams.Vector = sparse.Values
+		searchParams.SparseIndices = &qdrant.SparseIndices{Data: sparse.Indices}
+		searchParams.VectorName = &name
+	}
+	if offset > 0 {
+		o := uint64(offset)
+		searchParams.Offset = &o
 	}
 
 	resp, err := client.GetPointsClient().Search(context.Background(), searchParams)
@@ -87,14 +231,166 @@ func SearchQdrant(queryVector []float32, topK int) ([]SearchResult, error) {
 
 	var results []SearchResult
 	for _, point := range resp.Result {
-		payloadMap := convertPayload(point.Payload)
+		results = append(results, toSearchResult(point))
+	}
+	return results, nil
+}
 
-		results = append(results, SearchResult{
-			ID:      point.Id,
-			Score:   point.Score,
-			Payload: payloadMap,
-		})
+// pointKey identifie un point pour fusionner plusieurs listes de résultats.
+func pointKey(r SearchResult) string {
+	if id, ok := r.ID.(*qdrant.PointId); ok {
+		if u := id.GetUuid(); u != "" {
+			return u
+		}
+		return fmt.Sprintf("%d", id.GetNum())
 	}
+	return fmt.Sprintf("%v", r.ID)
+}
 
-	return results, nil
+// fuseRRF combine des listes classées par Reciprocal Rank Fusion : chaque
+// point reçoit la somme de 1/(k + rang) sur les listes où il apparaît.
+func fuseRRF(lists ...[]SearchResult) []SearchResult {
+	scores := make(map[string]float64)
+	first := make(map[string]SearchResult)
+	var order []string
+	for _, list := range lists {
+		for rank, r := range list {
+			key := pointKey(r)
+			if _, seen := first[key]; !seen {
+				first[key] = r
+				order = append(order, key)
+			}
+			scores[key] += 1.0 / float64(rrfK+rank+1)
+		}
+	}
+
+	fused := make([]SearchResult, 0, len(order))
+	for _, key := range order {
+		r := first[key]
+		r.Score = float32(scores[key])
+		fused = append(fused, r)
+	}
+	sort.SliceStable(fused, func(i, k int) bool { return fused[i].Score > fused[k].Score })
+	return fused
+}
+
+func SearchQdrant(opts SearchOptions) ([]SearchResult, error) {
+	if err := ValidateSearchMode(opts.Mode); err != nil {
+		return nil, err
+	}
+	filter, err := buildSearchFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	client, collection, err := getQdrantClient()
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Mode {
+	case SearchSparse:
+		sparse := SparseQuery(opts.QueryText)
+		if len(sparse.Indices) == 0 {
+			// Aucun terme indexable dans la requête
+			return []SearchResult{}, nil
+		}
+		return searchLeg(client, collection, filter, opts, &sparse, opts.TopK, opts.Offset)
+
+	case SearchHybrid:
+		// Chaque liste fournit assez de candidats pour couvrir offset + top_k
+		limit := opts.Offset + opts.TopK
+		if limit < hybridMinCandidates {
+			limit = hybridMinCandidates
+		}
+		dense, err := searchLeg(client, collection, filter, opts, nil, limit, 0)
+		if err != nil {
+			return nil, err
+		}
+		// Les scores BM25 ne sont pas sur l'échelle du seuil : il ne
+		// s'applique qu'à la liste dense
+		lexicalOpts := opts
+		lexicalOpts.ScoreThreshold = nil
+		var lexical []SearchResult
+		if sparse := SparseQuery(opts.QueryText); len(sparse.Indices) > 0 {
+			lexical, err = searchLeg(client, collection, filter, lexicalOpts, &sparse, limit, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		return pageResults(fuseRRF(dense, lexical), opts.Offset, opts.TopK), nil
+
+	default:
+		return searchLeg(client, collection, filter, opts, nil, opts.TopK, opts.Offset)
+	}
+}
+
+// SearchQdrantGroups recherche les TopK meilleurs groupes de points partageant
+// la même valeur de opts.GroupBy (API search groups de Qdrant), pour qu'une
+// ligne découpée en plusieurs morceaux n'occupe pas tous les résultats.
+func SearchQdrantGroups(opts SearchOptions) ([]SearchGroup, error) {
+	filter, err := buildSearchFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+	groupBy, err := GroupByField(opts.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateSearchMode(opts.Mode); err != nil {
+		return nil, err
+	}
+	if opts.Mode == SearchHybrid {
+		return nil, fmt.Errorf("group_by n'est pas supporté en mode hybrid")
+	}
+	if opts.GroupSize <= 0 {
+		opts.GroupSize = 1
+	}
+
+	client, collection, err := getQdrantClient()
+	if err != nil {
+		return nil, err
+	}
+
+	params := &qdrant.SearchPointGroups{
+		CollectionName: collection,
+		Vector:         opts.Vector,
+		Filter:         filter,
+		Limit:          uint32(opts.TopK),
+		WithPayload:    withPayloadSelector(opts.WithPayload),
+		ScoreThreshold: opts.ScoreThreshold,
+		GroupBy:        groupBy,
+		GroupSize:      uint32(opts.GroupSize),
+	}
+	if opts.Mode == SearchSparse {
+		name := SparseVectorName()
+		sparse := SparseQuery(opts.QueryText)
+		params.Vector = sparse.Values
+		params.SparseIndices = &qdrant.SparseIndices{Data: sparse.Indices}
+		params.VectorName = &name
+	}
+
+	resp, err := client.GetPointsClient().SearchGroups(context.Background(), params)
+	if err != nil {
+		return nil, fmt.Errorf("échec recherche groupée Qdrant : %w", err)
+	}
+
+	groups := []SearchGroup{}
+	for _, g := range resp.GetResult().GetGroups() {
+		group := SearchGroup{}
+		switch id := g.GetId().GetKind().(type) {
+		case *qdrant.GroupId_StringValue:
+			group.Key = id.StringValue
+		case *qdrant.GroupId_IntegerValue:
+			group.Key = id.IntegerValue
+		case *qdrant.GroupId_UnsignedValue:
+			group.Key = id.UnsignedValue
+		}
+		for _, hit := range g.GetHits() {
+			group.Hits = append(group.Hits, toSearchResult(hit))
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
 }
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/qdrant/go-client/qdrant"
+)
+
+func TestFuseRRF(t *testing.T) {
+	result := func(id uint64, source string) SearchResult {
+		return SearchResult{ID: qdrant.NewIDNum(id), Payload: map[string]interface{}{"source": source}}
+	}
+	dense := []SearchResult{result(1, "dense"), result(2, "dense"), result(3, "dense")}
+	sparse := []SearchResult{result(3, "sparse"), result(1, "sparse"), result(4, "sparse")}
+
+	fused := fuseRRF(dense, sparse)
+
+	// 1 : 1/61 + 1/62 ; 3 : 1/63 + 1/61 ; 2 : 1/62 ; 4 : 1/63
+	want := []struct {
+		id    uint64
+		score float64
+	}{
+		{1, 1.0/61 + 1.0/62},
+		{3, 1.0/63 + 1.0/61},
+		{2, 1.0 / 62},
+		{4, 1.0 / 63},
+	}
+	if len(fused) != len(want) {
+		t.Fatalf("%d résultats, attendu %d", len(fused), len(want))
+	}
+	for i, w := range want {
+		r := fused[i]
+		if r.ID.(*qdrant.PointId).GetNum() != w.id || r.Score != float32(w.score) {
+			t.Errorf("rang %d : point %v score %v, attendu %d score %v", i, r.ID, r.Score, w.id, float32(w.score))
+		}
+	}
+	// Le payload retenu est celui de la première liste où le point apparaît
+	if fused[1].Payload["source"] != "dense" || fused[3].Payload["source"] != "sparse" {
+		t.Errorf("payloads inattendus : %v, %v", fused[1].Payload, fused[3].Payload)
+	}
+}
+
+func TestFuseRRFTies(t *testing.T) {
+	a := SearchResult{ID: qdrant.NewID("5f0c1d2e-0000-4000-8000-000000000001")}
+	b := SearchResult{ID: qdrant.NewID("5f0c1d2e-0000-4000-8000-000000000002")}
+
+	// Même rang dans deux listes : l'ordre d'apparition départage
+	fused := fuseRRF([]SearchResult{a}, []SearchResult{b})
+	if len(fused) != 2 || pointKey(fused[0]) != pointKey(a) || fused[0].Score != fused[1].Score {
+		t.Errorf("égalité mal départagée : %v", fused)
+	}
+	if got := fuseRRF(); len(got) != 0 {
+		t.Errorf("aucun résultat attendu, reçu %v", got)
+	}
+}
@@ -3,60 +3,108 @@ package utils
 import (
 	"context"
 	"fmt"
-	"os"
-	"strconv"
 
 	"github.com/google/uuid"
 	"github.com/qdrant/go-client/qdrant"
 )
 
+// Document est un texte à vectoriser avec les métadonnées de sa ligne source.
+type Document struct {
+	Text       string
+	Source     string
+	OwnerID    string
+	DataID     string
+	ChunkIndex int
+	// Colonnes de la ligne copiées dans le payload sous "fields" (optionnel)
+	Fields map[string]interface{}
+}
+
+// pointNamespace est l'espace de noms des UUIDv5 des points Qdrant.
+var pointNamespace = uuid.MustParse("6f1c3c1e-5d8a-4c39-9a57-2f1d0c3b7e41")
+
+// PointID dérive un identifiant stable d'un morceau de ligne : vectoriser de
+// nouveau la même ligne écrase le point existant au lieu d'en créer un autre.
+func PointID(ownerID, source, dataID string, chunkIndex int) string {
+	name := fmt.Sprintf("%s\x00%s\x00%s\x00%d", ownerID, source, dataID, chunkIndex)
+	return uuid.NewSHA1(pointNamespace, []byte(name)).String()
+}
+
 func SendToQdrant(text, source string, userId string, dataId string) error {
-	host := os.Getenv("QDRANT_HOST")
-	portStr := os.Getenv("QDRANT_PORT")
-	apiKey := os.Getenv("QDRANT_API_KEY")
-	collection := os.Getenv("QDRANT_COLLECTION")
+	return SendBatchToQdrant([]Document{{
+		Text:    text,
+		Source:  source,
+		OwnerID: userId,
+		DataID:  dataId,
+	}})
+}
 
-	if host == "" || portStr == "" || collection == "" {
-		return fmt.Errorf("env QDRANT_HOST, QDRANT_PORT ou QDRANT_COLLECTION manquantes")
+// SendBatchToQdrant vectorise tous les documents en un seul appel à l'embedder
+// puis les envoie à Qdrant en un seul Upsert.
+func SendBatchToQdrant(docs []Document) error {
+	if len(docs) == 0 {
+		return nil
 	}
-	port, err := strconv.Atoi(portStr)
+
+	client, collection, err := getQdrantClient()
 	if err != nil {
-		return fmt.Errorf("QDRANT_PORT invalide : %w", err)
+		return err
 	}
 
-	cfg := qdrant.Config{
-		Host:   host,
-		Port:   int(port),
-		APIKey: apiKey,
-		UseTLS: true,
-	}
-	client, err := qdrant.NewClient(&cfg)
+	embedder, err := GetEmbedder()
 	if err != nil {
-		return fmt.Errorf("erreur création client Qdrant : %w", err)
+		return fmt.Errorf("erreur configuration embedder : %w", err)
+	}
+
+	texts := make([]string, len(docs))
+	for i, doc := range docs {
+		texts[i] = doc.Text
 	}
 
-	vector, err := Embed(text)
+	vectors, err := embedder.EmbedBatch(texts)
 	if err != nil {
 		return fmt.Errorf("erreur embedder : %w", err)
 	}
 
-	// Générer un UUID string
-	id := uuid.New().String()
-
-	point := &qdrant.PointStruct{
-		Id:      qdrant.NewIDUUID(id), // utiliser NewIDString pour un UUID
-		Vectors: qdrant.NewVectors(vector...),
-		Payload: qdrant.NewValueMap(map[string]any{
-			"text":     text,
-			"source":   source,
-			"owner_id": userId,
-			"data_id":  dataId,
-		}),
+	sparseName := SparseVectorName()
+	points := make([]*qdrant.PointStruct, len(docs))
+	for i, doc := range docs {
+		id := PointID(doc.OwnerID, doc.Source, doc.DataID, doc.ChunkIndex)
+
+		payload := map[string]any{
+			"text":        doc.Text,
+			"source":      doc.Source,
+			"owner_id":    doc.OwnerID,
+			"data_id":     doc.DataID,
+			"chunk_index": doc.ChunkIndex,
+		}
+		if len(doc.Fields) > 0 {
+			payload[FieldsPayloadKey] = doc.Fields
+		}
+		payloadValues, err := qdrant.TryValueMap(payload)
+		if err != nil {
+			return fmt.Errorf("payload invalide pour %s : %w", doc.DataID, err)
+		}
+
+		// Vecteur dense (sans nom) et, si la collection le porte, vecteur creux BM25
+		pointVectors := qdrant.NewVectors(vectors[i]...)
+		if sparseName != "" {
+			sparse := SparseDocument(doc.Text)
+			pointVectors = qdrant.NewVectorsMap(map[string]*qdrant.Vector{
+				"":         qdrant.NewVectorDense(vectors[i]),
+				sparseName: qdrant.NewVectorSparse(sparse.Indices, sparse.Values),
+			})
+		}
+
+		points[i] = &qdrant.PointStruct{
+			Id:      qdrant.NewIDUUID(id),
+			Vectors: pointVectors,
+			Payload: payloadValues,
+		}
 	}
 
 	_, err = client.Upsert(context.Background(), &qdrant.UpsertPoints{
 		CollectionName: collection,
-		Points:         []*qdrant.PointStruct{point},
+		Points:         points,
 	})
 	if err != nil {
 		return fmt.Errorf("échec upsert Qdrant : %w", err)
@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Vecteurs creux de type BM25 calculés en Go. Chaque terme est haché en un
+// indice ; le poids stocké est la composante TF saturée de BM25 et l'IDF est
+// appliquée par Qdrant (modifier Idf du vecteur creux).
+
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// bm25AvgDocLength approxime la longueur moyenne (en termes) d'une ligne
+	// rendue par un template.
+	bm25AvgDocLength = 64.0
+)
+
+// DefaultSparseVectorName est le nom du vecteur creux créé avec la collection.
+const DefaultSparseVectorName = "bm25"
+
+var (
+	sparseMu         sync.RWMutex
+	sparseVectorName string
+)
+
+// SetSparseVectorName active (nom non vide) ou désactive l'écriture et la
+// recherche du vecteur creux, selon ce que porte la collection.
+func SetSparseVectorName(name string) {
+	sparseMu.Lock()
+	defer sparseMu.Unlock()
+	sparseVectorName = name
+}
+
+// SparseVectorName retourne le nom du vecteur creux, vide s'il est désactivé.
+func SparseVectorName() string {
+	sparseMu.RLock()
+	defer sparseMu.RUnlock()
+	return sparseVectorName
+}
+
+// SparseVector est un vecteur creux au format Qdrant.
+type SparseVector struct {
+	Indices []uint32
+	Values  []float32
+}
+
+// tokenize découpe le texte en termes minuscules alphanumériques.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func termIndex(term string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(term))
+	return h.Sum32()
+}
+
+// termFrequencies compte les occurrences de chaque indice de terme.
+func termFrequencies(terms []string) map[uint32]float64 {
+	tf := make(map[uint32]float64, len(terms))
+	for _, t := range terms {
+		tf[termIndex(t)]++
+	}
+	return tf
+}
+
+func toSparseVector(weights map[uint32]float64) SparseVector {
+	v := SparseVector{
+		Indices: make([]uint32, 0, len(weights)),
+		Values:  make([]float32, 0, len(weights)),
+	}
+	for idx := range weights {
+		v.Indices = append(v.Indices, idx)
+	}
+	sort.Slice(v.Indices, func(i, k int) bool { return v.Indices[i] < v.Indices[k] })
+	for _, idx := range v.Indices {
+		v.Values = append(v.Values, float32(weights[idx]))
+	}
+	return v
+}
+
+// SparseDocument calcule le vecteur creux BM25 d'un document indexé.
+func SparseDocument(text string) SparseVector {
+	terms := tokenize(text)
+	tf := termFrequencies(terms)
+	norm := bm25K1 * (1 - bm25B + bm25B*float64(len(terms))/bm25AvgDocLength)
+	for idx, f := range tf {
+		tf[idx] = f * (bm25K1 + 1) / (f + norm)
+	}
+	return toSparseVector(tf)
+}
+
+// SparseQuery calcule le vecteur creux d'une requête : poids 1 par terme.
+func SparseQuery(text string) SparseVector {
+	tf := termFrequencies(tokenize(text))
+	for idx := range tf {
+		tf[idx] = 1
+	}
+	return toSparseVector(tf)
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("L'Année 2024, café-crème !")
+	want := []string{"l", "année", "2024", "café", "crème"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tokenize : %q, attendu %q", got, want)
+	}
+}
+
+func TestTermIndexStable(t *testing.T) {
+	// Les indices sont stockés dans Qdrant : le hachage (FNV-1a 32 bits) ne
+	// doit pas changer d'une version à l'autre.
+	if got := termIndex("a"); got != 0xe40c292c {
+		t.Errorf("termIndex(a) = %#x", got)
+	}
+}
+
+func TestSparseQuery(t *testing.T) {
+	v := SparseQuery("chat Chat chien")
+	want := []uint32{termIndex("chat"), termIndex("chien")}
+	slices.Sort(want)
+	if !slices.Equal(v.Indices, want) {
+		t.Errorf("indices %v, attendu %v", v.Indices, want)
+	}
+	if !slices.Equal(v.Values, []float32{1, 1}) {
+		t.Errorf("poids %v, attendu 1 par terme", v.Values)
+	}
+	if v := SparseQuery(" ?! "); len(v.Indices) != 0 {
+		t.Errorf("aucun terme attendu, reçu %v", v.Indices)
+	}
+}
+
+func TestSparseDocument(t *testing.T) {
+	v := SparseDocument("chat chat chien")
+	if len(v.Indices) != 2 || !slices.IsSorted(v.Indices) {
+		t.Fatalf("deux indices triés attendus, reçu %v", v.Indices)
+	}
+
+	// Composante TF de BM25 pour un document de 3 termes
+	norm := bm25K1 * (1 - bm25B + bm25B*3/bm25AvgDocLength)
+	weight := func(f float64) float64 { return f * (bm25K1 + 1) / (f + norm) }
+	want := map[uint32]float64{termIndex("chat"): weight(2), termIndex("chien"): weight(1)}
+	for i, idx := range v.Indices {
+		if math.Abs(float64(v.Values[i])-want[idx]) > 1e-6 {
+			t.Errorf("poids de %d : %v, attendu %v", idx, v.Values[i], want[idx])
+		}
+	}
+
+	// La fréquence sature : 100 occurrences pèsent moins que k1 + 1
+	long := SparseDocument(strings.Repeat("mot ", 100))
+	if long.Values[0] >= bm25K1+1 || long.Values[0] <= float32(weight(2)) {
+		t.Errorf("poids saturé inattendu : %v", long.Values[0])
+	}
+}
@@ -0,0 +1,367 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"google.golang.org/protobuf/proto"
+)
+
+// SQLParam est une valeur liée à un placeholder $n. Dans le JSON, c'est soit
+// une valeur brute (chaîne, nombre, booléen, null, tableau), soit un objet
+// {"value": ..., "type": "..."} précisant le type attendu.
+type SQLParam struct {
+	Value interface{}
+	Type  string
+}
+
+func (p *SQLParam) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber() // préserve les grands entiers et les décimaux
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	if obj, ok := raw.(map[string]interface{}); ok {
+		if _, hasValue := obj["value"]; hasValue {
+			typ, _ := obj["type"].(string)
+			p.Value, p.Type = obj["value"], strings.ToLower(strings.TrimSpace(typ))
+			return nil
+		}
+	}
+	p.Value, p.Type = raw, ""
+	return nil
+}
+
+func (p SQLParam) MarshalJSON() ([]byte, error) {
+	if p.Type == "" {
+		return json.Marshal(p.Value)
+	}
+	return json.Marshal(map[string]interface{}{"value": p.Value, "type": p.Type})
+}
+
+// paramTypes associe les types acceptés (et leurs alias) à leur type de base.
+var paramTypes = map[string]string{
+	"text": "text", "varchar": "text", "string": "text",
+	"int": "int", "integer": "int", "bigint": "int", "smallint": "int", "int4": "int", "int8": "int",
+	"numeric": "numeric", "decimal": "numeric",
+	"float": "float", "double": "float", "real": "float", "float8": "float", "float4": "float",
+	"bool": "bool", "boolean": "bool",
+	"timestamp": "timestamp", "timestamptz": "timestamp",
+	"date": "date",
+	"uuid": "uuid",
+	"json": "json", "jsonb": "json",
+}
+
+// timestampLayouts sont les formats acceptés pour les horodatages.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+}
+
+// pgTypeNames donne le nom PostgreSQL des alias de paramTypes qui n'en sont
+// pas ; les autres clés de paramTypes sont déjà des noms de types valides.
+var pgTypeNames = map[string]string{
+	"string": "text",
+	"double": "double precision",
+}
+
+// pgTypeName retourne le type PostgreSQL d'un type de paramètre (suffixe []
+// compris), ou false s'il est inconnu.
+func pgTypeName(typ string) (string, bool) {
+	elem, isArray := strings.CutSuffix(typ, "[]")
+	if _, ok := paramTypes[elem]; !ok {
+		return "", false
+	}
+	if name, ok := pgTypeNames[elem]; ok {
+		elem = name
+	}
+	if isArray {
+		elem += "[]"
+	}
+	return elem, true
+}
+
+// sqlParamRefs retourne les placeholders $n de query, dans l'ordre du texte.
+func sqlParamRefs(query string) ([]*pg_query.ParamRef, error) {
+	tree, err := parseSQL(query)
+	if err != nil {
+		return nil, err
+	}
+	var refs []*pg_query.ParamRef
+	for _, raw := range tree.Stmts {
+		walkSQL(raw.ProtoReflect(), int(raw.StmtLocation), func(node proto.Message, pos int) error {
+			if ref, ok := node.(*pg_query.ParamRef); ok {
+				refs = append(refs, ref)
+			}
+			return nil
+		})
+	}
+	slices.SortFunc(refs, func(a, b *pg_query.ParamRef) int { return int(a.Location - b.Location) })
+	return refs, nil
+}
+
+// countParamRefs retourne le plus grand numéro de placeholder et vérifie que
+// les numéros vont de $1 à $n sans trou.
+func countParamRefs(refs []*pg_query.ParamRef) (int, error) {
+	used := make(map[int]bool, len(refs))
+	highest := 0
+	for _, ref := range refs {
+		n := int(ref.Number)
+		used[n] = true
+		if n > highest {
+			highest = n
+		}
+	}
+	for n := 1; n <= highest; n++ {
+		if !used[n] {
+			return 0, fmt.Errorf("placeholder $%d absent : les placeholders doivent aller de $1 à $%d sans trou", n, highest)
+		}
+	}
+	return highest, nil
+}
+
+// CountSQLParams retourne le nombre de placeholders $1..$n de query. Une
+// numérotation avec des trous ($1, $3) est refusée.
+func CountSQLParams(query string) (int, error) {
+	refs, err := sqlParamRefs(query)
+	if err != nil {
+		return 0, err
+	}
+	return countParamRefs(refs)
+}
+
+// BindSQLParams vérifie que params couvre exactement les placeholders de query
+// et convertit chaque valeur selon son type. La requête retournée caste chaque
+// placeholder typé ($n devient ($n::type)) pour que le serveur n'ait pas à
+// déduire le type du contexte.
+func BindSQLParams(query string, params []SQLParam) (string, []interface{}, error) {
+	refs, err := sqlParamRefs(query)
+	if err != nil {
+		return "", nil, err
+	}
+	expected, err := countParamRefs(refs)
+	if err != nil {
+		return "", nil, err
+	}
+	if expected != len(params) {
+		return "", nil, fmt.Errorf("la requête attend %d paramètre(s), %d fourni(s)", expected, len(params))
+	}
+
+	args := make([]interface{}, len(params))
+	casts := make([]string, len(params))
+	for i, p := range params {
+		arg, err := p.bind()
+		if err != nil {
+			return "", nil, fmt.Errorf("paramètre $%d : %w", i+1, err)
+		}
+		args[i] = arg
+		if p.Type != "" {
+			name, ok := pgTypeName(p.Type)
+			if !ok {
+				return "", nil, fmt.Errorf("paramètre $%d : type inconnu : %q", i+1, p.Type)
+			}
+			casts[i] = name
+		}
+	}
+
+	// Réécriture de la fin vers le début pour garder les positions valides
+	for i := len(refs) - 1; i >= 0; i-- {
+		cast := casts[refs[i].Number-1]
+		if cast == "" {
+			continue
+		}
+		start := int(refs[i].Location)
+		end := start + 1
+		for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+			end++
+		}
+		query = query[:start] + "(" + query[start:end] + "::" + cast + ")" + query[end:]
+	}
+	return query, args, nil
+}
+
+// bind convertit le paramètre en argument pour le driver.
+func (p SQLParam) bind() (interface{}, error) {
+	if p.Value == nil {
+		return nil, nil
+	}
+
+	if elemType, isArray := strings.CutSuffix(p.Type, "[]"); isArray {
+		list, ok := p.Value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("tableau attendu pour le type %s", p.Type)
+		}
+		return arrayLiteral(list, elemType)
+	}
+
+	if p.Type == "" {
+		// Sans indication, le serveur déduit le type du contexte
+		switch v := p.Value.(type) {
+		case []interface{}:
+			return arrayLiteral(v, "")
+		case map[string]interface{}:
+			return bindValue(v, "json")
+		}
+		return bindValue(p.Value, "")
+	}
+	return bindValue(p.Value, p.Type)
+}
+
+// bindValue convertit une valeur scalaire (ou un objet JSON) vers typ.
+func bindValue(v interface{}, typ string) (interface{}, error) {
+	base := ""
+	if typ != "" {
+		var ok bool
+		if base, ok = paramTypes[typ]; !ok {
+			return nil, fmt.Errorf("type inconnu : %q", typ)
+		}
+	}
+
+	switch base {
+	case "":
+		switch val := v.(type) {
+		case json.Number:
+			return val.String(), nil
+		case string, bool:
+			return val, nil
+		}
+		return nil, fmt.Errorf("valeur non supportée : %v", v)
+
+	case "text":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return fmt.Sprint(v), nil
+
+	case "int":
+		s := scalarText(v)
+		if _, ok := new(big.Int).SetString(s, 10); !ok {
+			return nil, fmt.Errorf("entier attendu, reçu %q", s)
+		}
+		return s, nil
+
+	case "numeric":
+		s := scalarText(v)
+		if _, ok := new(big.Float).SetString(s); !ok {
+			return nil, fmt.Errorf("nombre attendu, reçu %q", s)
+		}
+		return s, nil
+
+	case "float":
+		f, err := strconv.ParseFloat(scalarText(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("nombre attendu, reçu %v", v)
+		}
+		return f, nil
+
+	case "bool":
+		switch val := v.(type) {
+		case bool:
+			return val, nil
+		case string:
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("booléen attendu, reçu %q", val)
+			}
+			return b, nil
+		}
+		return nil, fmt.Errorf("booléen attendu, reçu %v", v)
+
+	case "timestamp":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("horodatage attendu sous forme de chaîne")
+		}
+		for _, layout := range timestampLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("horodatage invalide %q (RFC 3339 attendu)", s)
+
+	case "date":
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("date attendue sous forme de chaîne")
+		}
+		if _, err := time.Parse("2006-01-02", s); err != nil {
+			return nil, fmt.Errorf("date invalide %q (AAAA-MM-JJ attendu)", s)
+		}
+		return s, nil
+
+	case "uuid":
+		s, _ := v.(string)
+		if _, err := uuid.Parse(s); err != nil {
+			return nil, fmt.Errorf("uuid invalide %q", s)
+		}
+		return s, nil
+
+	case "json":
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return nil, fmt.Errorf("type inconnu : %q", typ)
+}
+
+func scalarText(v interface{}) string {
+	if n, ok := v.(json.Number); ok {
+		return n.String()
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
+
+// arrayLiteral construit le littéral de tableau PostgreSQL {"a","b",NULL},
+// chaque élément étant converti vers elemType.
+func arrayLiteral(list []interface{}, elemType string) (string, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, elem := range list {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if elem == nil {
+			b.WriteString("NULL")
+			continue
+		}
+		if _, nested := elem.([]interface{}); nested {
+			return "", fmt.Errorf("tableaux imbriqués non supportés")
+		}
+		typ := elemType
+		if _, isObject := elem.(map[string]interface{}); isObject && typ == "" {
+			typ = "json"
+		}
+		arg, err := bindValue(elem, typ)
+		if err != nil {
+			return "", fmt.Errorf("élément %d : %w", i, err)
+		}
+		var text string
+		switch val := arg.(type) {
+		case time.Time:
+			text = val.Format(time.RFC3339Nano)
+		case float64:
+			text = strconv.FormatFloat(val, 'g', -1, 64)
+		default:
+			text = fmt.Sprint(val)
+		}
+		b.WriteByte('"')
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String(), nil
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decodeParams(t *testing.T, raw string) []SQLParam {
+	t.Helper()
+	var params []SQLParam
+	if err := json.Unmarshal([]byte(raw), &params); err != nil {
+		t.Fatal(err)
+	}
+	return params
+}
+
+func TestCountSQLParams(t *testing.T) {
+	tests := []struct {
+		query string
+		want  int
+		err   bool
+	}{
+		{"SELECT 1", 0, false},
+		{"SELECT $1, $2, $1", 2, false},
+		{"SELECT '$3', $1 /* $4 */", 1, false},
+		{"SELECT $1, $3", 0, true},
+		{"SELECT $2", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := CountSQLParams(tt.query)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%q : %d, %v ; attendu %d (erreur : %v)", tt.query, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestBindSQLParamsCasts(t *testing.T) {
+	query := "SELECT * FROM t WHERE id = $1 AND tags && $2 AND name = $3 AND $1 > 0 AND note <> '$1'"
+	params := decodeParams(t, `[{"value": 42, "type": "bigint"}, {"value": ["a", "b"], "type": "string[]"}, "x"]`)
+
+	got, args, err := BindSQLParams(query, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SELECT * FROM t WHERE id = ($1::bigint) AND tags && ($2::text[]) AND name = $3 AND ($1::bigint) > 0 AND note <> '$1'"
+	if got != want {
+		t.Errorf("requête réécrite :\n%s\nattendu :\n%s", got, want)
+	}
+	if len(args) != 3 || args[0] != "42" || args[1] != `{"a","b"}` || args[2] != "x" {
+		t.Errorf("arguments inattendus : %#v", args)
+	}
+}
+
+func TestBindSQLParamsTypeNames(t *testing.T) {
+	got, _, err := BindSQLParams("SELECT $1, $2", decodeParams(t, `[{"value": 1.5, "type": "double"}, {"value": null, "type": "timestamptz"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "SELECT ($1::double precision), ($2::timestamptz)" {
+		t.Errorf("requête réécrite : %s", got)
+	}
+}
+
+func TestBindSQLParamsErrors(t *testing.T) {
+	tests := []struct {
+		query  string
+		params string
+		msg    string
+	}{
+		{"SELECT $1, $2", `[1]`, "attend 2"},
+		{"SELECT $1, $3", `[1, 2, 3]`, "$2 absent"},
+		{"SELECT $1", `[{"value": "x", "type": "int"}]`, "entier attendu"},
+		// Le type n'est jamais recopié dans la requête sans être reconnu
+		{"SELECT $1", `[{"value": [], "type": "int); DROP TABLE t; --[]"}]`, "type inconnu"},
+	}
+	for _, tt := range tests {
+		_, _, err := BindSQLParams(tt.query, decodeParams(t, tt.params))
+		if err == nil || !strings.Contains(err.Error(), tt.msg) {
+			t.Errorf("%q %s : erreur contenant %q attendue, reçu %v", tt.query, tt.params, tt.msg, err)
+		}
+	}
+}
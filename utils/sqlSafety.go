@@ -0,0 +1,235 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+	"github.com/pganalyze/pg_query_go/v6/parser"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Vérification des requêtes SQL soumises en lecture seule (/execute, /nl2sql).
+//
+// La requête est analysée par le parseur de PostgreSQL lui-même (libpg_query) :
+// chaînes, commentaires, identifiants entre guillemets et échappements U&""
+// sont résolus comme par le serveur, et les règles portent sur l'arbre
+// syntaxique obtenu plutôt que sur le texte.
+
+// Règles de sécurité SQL
+const (
+	RuleSyntax         = "syntax"          // requête vide ou mal formée
+	RuleMultiStatement = "multi_statement" // plusieurs instructions
+	RuleStatementType  = "statement_type"  // instruction autre que SELECT / WITH / VALUES / TABLE
+	RuleWrite          = "write"           // INSERT, UPDATE, DELETE, MERGE (y compris dans un WITH)
+	RuleSelectInto     = "select_into"     // SELECT ... INTO crée une table
+	RuleLocking        = "locking"         // FOR UPDATE / FOR SHARE posent des verrous
+	RuleFunction       = "function"        // fonction interdite
+)
+
+// SQLSafetyError décrit la règle violée par une requête.
+type SQLSafetyError struct {
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+	Token    string `json:"token,omitempty"`
+	Position int    `json:"position"` // position (octet) du jeton fautif
+}
+
+func (e *SQLSafetyError) Error() string {
+	return fmt.Sprintf("requête refusée (%s) : %s", e.Rule, e.Message)
+}
+
+// defaultDeniedFunctions sont les fonctions qui agissent sur le serveur, le
+// système de fichiers, d'autres sessions ou d'autres bases, ou qui exécutent
+// du SQL arbitraire, même appelées depuis un SELECT.
+var defaultDeniedFunctions = []string{
+	// Sessions et serveur
+	"pg_terminate_backend", "pg_cancel_backend", "pg_reload_conf", "pg_rotate_logfile",
+	"pg_promote", "pg_switch_wal", "pg_create_restore_point", "pg_backup_start", "pg_backup_stop",
+	"pg_sleep", "pg_sleep_for", "pg_sleep_until", "set_config", "pg_notify",
+	// Verrous consultatifs
+	"pg_advisory_lock", "pg_advisory_lock_shared", "pg_advisory_xact_lock", "pg_advisory_xact_lock_shared",
+	"pg_try_advisory_lock", "pg_try_advisory_lock_shared", "pg_try_advisory_xact_lock", "pg_try_advisory_xact_lock_shared",
+	"pg_advisory_unlock", "pg_advisory_unlock_shared", "pg_advisory_unlock_all",
+	// Fichiers et objets larges
+	"pg_read_file", "pg_read_binary_file", "pg_ls_dir", "pg_stat_file", "pg_ls_logdir", "pg_ls_waldir",
+	"pg_ls_tmpdir", "pg_ls_archive_statusdir", "pg_file_write", "pg_file_rename", "pg_file_unlink",
+	"lo_import", "lo_export", "lo_unlink", "lo_create", "lo_creat", "lo_put", "lo_from_bytea", "lo_truncate",
+	"lo_truncate64", "lo_get", "lo_open", "lo_close", "loread", "lowrite", "lo_lseek", "lo_lseek64", "lo_tell", "lo_tell64",
+	// Réplication
+	"pg_create_logical_replication_slot", "pg_create_physical_replication_slot", "pg_drop_replication_slot",
+	"pg_copy_logical_replication_slot", "pg_copy_physical_replication_slot", "pg_replication_slot_advance",
+	"pg_logical_slot_get_changes", "pg_logical_slot_get_binary_changes", "pg_logical_emit_message",
+	// Séquences
+	"nextval", "setval",
+	// Exécution de SQL arbitraire ou distant
+	"query_to_xml", "query_to_xmlschema", "query_to_xml_and_xmlschema", "cursor_to_xml",
+	"dblink", "dblink_exec", "dblink_connect", "dblink_connect_u", "dblink_send_query", "dblink_open",
+}
+
+// deniedFunctions retourne la liste des fonctions interdites : la liste par
+// défaut, plus SQL_FUNCTION_DENYLIST, moins SQL_FUNCTION_ALLOWLIST (noms
+// séparés par des virgules).
+func deniedFunctions() map[string]bool {
+	denied := make(map[string]bool, len(defaultDeniedFunctions))
+	for _, name := range defaultDeniedFunctions {
+		denied[name] = true
+	}
+	for _, name := range strings.Split(os.Getenv("SQL_FUNCTION_DENYLIST"), ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			denied[name] = true
+		}
+	}
+	for _, name := range strings.Split(os.Getenv("SQL_FUNCTION_ALLOWLIST"), ",") {
+		delete(denied, strings.ToLower(strings.TrimSpace(name)))
+	}
+	return denied
+}
+
+// parseSQL analyse query avec le parseur de PostgreSQL. Une erreur de syntaxe
+// est retournée sous forme de *SQLSafetyError (règle syntax).
+func parseSQL(query string) (*pg_query.ParseResult, error) {
+	tree, err := pg_query.Parse(query)
+	if err == nil {
+		return tree, nil
+	}
+	safetyErr := &SQLSafetyError{Rule: RuleSyntax, Message: err.Error()}
+	var pgErr *parser.Error
+	if errors.As(err, &pgErr) && pgErr.Cursorpos > 0 {
+		// Cursorpos compte les caractères à partir de 1
+		runes := []rune(query)
+		if pos := pgErr.Cursorpos - 1; pos <= len(runes) {
+			safetyErr.Position = len(string(runes[:pos]))
+		}
+	}
+	return nil, safetyErr
+}
+
+// walkSQL parcourt en profondeur l'arbre syntaxique à partir de m et appelle
+// visit pour chaque nœud, avec la position (octet) du nœud ou, à défaut, celle
+// de son plus proche ancêtre qui en porte une. visit arrête le parcours en
+// retournant une erreur.
+func walkSQL(m protoreflect.Message, pos int, visit func(node proto.Message, pos int) error) error {
+	fields := m.Descriptor().Fields()
+	if fd := fields.ByName("location"); fd != nil && fd.Kind() == protoreflect.Int32Kind {
+		if loc := int(m.Get(fd).Int()); loc >= 0 {
+			pos = loc
+		}
+	}
+	if err := visit(m.Interface(), pos); err != nil {
+		return err
+	}
+
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if fd.Kind() != protoreflect.MessageKind {
+			return true
+		}
+		if fd.IsList() {
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = walkSQL(list.Get(i).Message(), pos, visit)
+			}
+		} else {
+			err = walkSQL(v.Message(), pos, visit)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// statementName retourne le nom d'un type d'instruction, en minuscules et sans
+// le suffixe Stmt (insert, create, copy...).
+func statementName(desc protoreflect.MessageDescriptor) string {
+	return strings.ToLower(strings.TrimSuffix(string(desc.Name()), "Stmt"))
+}
+
+// funcName retourne le nom qualifié d'un appel de fonction et son dernier
+// composant, tels que décodés par le parseur (guillemets et échappements U&
+// résolus).
+func funcName(call *pg_query.FuncCall) (qualified, name string) {
+	parts := make([]string, 0, len(call.Funcname))
+	for _, n := range call.Funcname {
+		parts = append(parts, n.GetString_().GetSval())
+	}
+	if len(parts) == 0 {
+		return "", ""
+	}
+	return strings.Join(parts, "."), parts[len(parts)-1]
+}
+
+// CheckReadOnlySQL vérifie qu'une requête est une unique lecture : un SELECT
+// (éventuellement précédé de WITH), VALUES ou TABLE, sans instruction
+// d'écriture, SELECT INTO, clause de verrouillage ni fonction interdite.
+// L'erreur retournée est un *SQLSafetyError.
+func CheckReadOnlySQL(query string) error {
+	tree, err := parseSQL(query)
+	if err != nil {
+		return err
+	}
+
+	if len(tree.Stmts) == 0 {
+		return &SQLSafetyError{Rule: RuleSyntax, Message: "requête vide"}
+	}
+	if len(tree.Stmts) > 1 {
+		return &SQLSafetyError{
+			Rule:     RuleMultiStatement,
+			Message:  "une seule instruction est autorisée",
+			Token:    ";",
+			Position: int(tree.Stmts[1].StmtLocation),
+		}
+	}
+
+	raw := tree.Stmts[0]
+	if raw.Stmt.GetSelectStmt() == nil {
+		m := raw.Stmt.ProtoReflect()
+		name := ""
+		if fd := m.WhichOneof(m.Descriptor().Oneofs().ByName("node")); fd != nil {
+			name = statementName(fd.Message())
+		}
+		return &SQLSafetyError{
+			Rule:     RuleStatementType,
+			Message:  fmt.Sprintf("seules les lectures (SELECT, WITH, VALUES, TABLE) sont autorisées, pas %s", strings.ToUpper(name)),
+			Token:    name,
+			Position: int(raw.StmtLocation),
+		}
+	}
+
+	denied := deniedFunctions()
+	return walkSQL(raw.Stmt.ProtoReflect(), int(raw.StmtLocation), func(node proto.Message, pos int) error {
+		switch n := node.(type) {
+		case *pg_query.InsertStmt, *pg_query.UpdateStmt, *pg_query.DeleteStmt, *pg_query.MergeStmt:
+			name := statementName(node.ProtoReflect().Descriptor())
+			return &SQLSafetyError{
+				Rule:     RuleWrite,
+				Message:  fmt.Sprintf("instruction d'écriture %s interdite, y compris dans un WITH", strings.ToUpper(name)),
+				Token:    name,
+				Position: pos,
+			}
+
+		case *pg_query.IntoClause:
+			if loc := n.GetRel().GetLocation(); loc >= 0 {
+				pos = int(loc)
+			}
+			return &SQLSafetyError{Rule: RuleSelectInto, Message: "SELECT ... INTO crée une table : interdit", Token: "into", Position: pos}
+
+		case *pg_query.LockingClause:
+			return &SQLSafetyError{Rule: RuleLocking, Message: "les clauses FOR UPDATE / FOR SHARE posent des verrous : interdites", Token: "for", Position: pos}
+
+		case *pg_query.FuncCall:
+			qualified, name := funcName(n)
+			if name = strings.ToLower(name); denied[name] {
+				return &SQLSafetyError{
+					Rule:     RuleFunction,
+					Message:  fmt.Sprintf("la fonction %s est interdite", name),
+					Token:    qualified,
+					Position: pos,
+				}
+			}
+		}
+		return nil
+	})
+}
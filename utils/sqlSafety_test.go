@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReadOnlySQL(t *testing.T) {
+	tests := []struct {
+		query string
+		rule  string // "" : requête acceptée
+		token string
+	}{
+		{"SELECT 1", "", ""},
+		{"select * from employee where name = 'DELETE FROM t; DROP TABLE t'", "", ""},
+		{"WITH t AS (SELECT 1 AS x) SELECT x FROM t", "", ""},
+		{"VALUES (1), (2)", "", ""},
+		{"TABLE employee", "", ""},
+		{"SELECT 1; -- commentaire final", "", ""},
+		{"/* DELETE FROM t */ SELECT $tag$;INSERT INTO t$tag$", "", ""},
+		{`SELECT "insert" FROM "update"`, "", ""},
+		{"SELECT lower(name) FROM employee", "", ""},
+
+		{"", RuleSyntax, ""},
+		{"SELECT FROM WHERE (", RuleSyntax, ""},
+		{"SELECT 1; SELECT 2", RuleMultiStatement, ";"},
+		{"DROP TABLE employee", RuleStatementType, "drop"},
+		{"EXPLAIN ANALYZE DELETE FROM employee", RuleStatementType, "explain"},
+		{"INSERT INTO employee VALUES (1)", RuleStatementType, "insert"},
+		{"WITH d AS (DELETE FROM employee RETURNING *) SELECT * FROM d", RuleWrite, "delete"},
+		{"WITH u AS (UPDATE employee SET name = 'x' RETURNING *) SELECT * FROM u", RuleWrite, "update"},
+		{"SELECT * INTO copie FROM employee", RuleSelectInto, "into"},
+		{"SELECT * FROM employee FOR UPDATE", RuleLocking, "for"},
+		{"SELECT * FROM (SELECT * FROM employee FOR SHARE) s", RuleLocking, "for"},
+		{"SELECT pg_sleep(5)", RuleFunction, "pg_sleep"},
+		{"SELECT pg_catalog.pg_terminate_backend(1)", RuleFunction, "pg_catalog.pg_terminate_backend"},
+		{`SELECT "PG_SLEEP"(1)`, RuleFunction, "PG_SLEEP"},
+		{"SELECT * FROM employee WHERE id IN (SELECT lo_get(42))", RuleFunction, "lo_get"},
+		// Identifiants U&"" : les échappements sont décodés avant comparaison
+		{`SELECT U&"pg_terminate_backen\0064"(pid) FROM pg_stat_activity`, RuleFunction, "pg_terminate_backend"},
+		{`SELECT U&"pg_sl\0065ep"(5)`, RuleFunction, "pg_sleep"},
+	}
+	for _, tt := range tests {
+		err := CheckReadOnlySQL(tt.query)
+		if tt.rule == "" {
+			if err != nil {
+				t.Errorf("%q : refusée à tort : %v", tt.query, err)
+			}
+			continue
+		}
+		var safetyErr *SQLSafetyError
+		if !errors.As(err, &safetyErr) {
+			t.Errorf("%q : *SQLSafetyError attendue, reçu %v", tt.query, err)
+			continue
+		}
+		if safetyErr.Rule != tt.rule || safetyErr.Token != tt.token {
+			t.Errorf("%q : règle %s / jeton %q, attendu %s / %q", tt.query, safetyErr.Rule, safetyErr.Token, tt.rule, tt.token)
+		}
+	}
+}
+
+func TestCheckReadOnlySQLPosition(t *testing.T) {
+	query := "SELECT id, pg_sleep(1) FROM employee"
+	var safetyErr *SQLSafetyError
+	if !errors.As(CheckReadOnlySQL(query), &safetyErr) || safetyErr.Position != 11 {
+		t.Errorf("position 11 attendue, reçu %+v", safetyErr)
+	}
+}
+
+func TestDeniedFunctionsEnv(t *testing.T) {
+	t.Setenv("SQL_FUNCTION_DENYLIST", "my_func")
+	t.Setenv("SQL_FUNCTION_ALLOWLIST", "pg_sleep")
+
+	if err := CheckReadOnlySQL("SELECT pg_sleep(1)"); err != nil {
+		t.Errorf("pg_sleep autorisée par SQL_FUNCTION_ALLOWLIST : %v", err)
+	}
+	if err := CheckReadOnlySQL("SELECT My_Func()"); err == nil {
+		t.Error("my_func interdite par SQL_FUNCTION_DENYLIST")
+	}
+}
@@ -0,0 +1,545 @@
+package vectorizer
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/lib/pq"
+)
+
+// CDCStream est l'abonnement persisté d'une table à un slot de réplication
+// logique pgoutput. Le slot conserve la position confirmée (LSN) : après un
+// redémarrage, le flux reprend là où il s'était arrêté. Request est persisté
+// sans mot de passe (voir withPassword).
+type CDCStream struct {
+	OwnerID     string               `json:"owner_id"`
+	Source      string               `json:"source"`
+	Request     models.FormatRequest `json:"request"`
+	Slot        string               `json:"slot"`
+	Publication string               `json:"publication"`
+	Enabled     bool                 `json:"enabled"`
+}
+
+// withoutPassword retourne le flux tel qu'il est persisté, sans mot de passe.
+func (s CDCStream) withoutPassword() CDCStream {
+	s.Request.ConnParams = withoutPassword(s.OwnerID, s.Request.ConnParams)
+	return s
+}
+
+// withPassword complète un flux relu dans le store avec son mot de passe.
+func (s CDCStream) withPassword() (CDCStream, error) {
+	params, err := withPassword(s.OwnerID, s.Request.ConnParams)
+	s.Request.ConnParams = params
+	return s, err
+}
+
+// StreamStatus décrit l'état d'un flux de synchronisation en temps réel.
+type StreamStatus struct {
+	Source       string     `json:"source"`
+	Running      bool       `json:"running"`
+	Slot         string     `json:"slot,omitempty"`
+	Publication  string     `json:"publication,omitempty"`
+	Channel      string     `json:"channel,omitempty"`
+	ConfirmedLSN string     `json:"confirmed_lsn,omitempty"`
+	RowsUpserted int        `json:"rows_upserted"`
+	RowsDeleted  int        `json:"rows_deleted"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastEventAt  *time.Time `json:"last_event_at,omitempty"`
+	// ResyncNeeded signale des modifications perdues (écoute NOTIFY coupée)
+	// qu'aucune synchronisation automatique n'a pu rattraper : relancer une
+	// vectorisation complète.
+	ResyncNeeded bool `json:"resync_needed,omitempty"`
+}
+
+var syncNameRe = regexp.MustCompile(`^[a-z0-9_]{1,63}$`)
+
+// DefaultSyncName dérive un nom d'objet PostgreSQL (slot, publication,
+// canal, trigger) stable et propre au couple propriétaire / source.
+func DefaultSyncName(ownerID, source string) string {
+	sum := sha1.Sum([]byte(ownerID + "/" + source))
+	return "vectorizer_" + hex.EncodeToString(sum[:])[:12]
+}
+
+func cdcKey(ownerID, source string) string {
+	return fmt.Sprintf("cdc/%s/%s", ownerID, source)
+}
+
+func cdcPollInterval() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("CDC_POLL_INTERVAL")); err == nil && d > 0 {
+		return d
+	}
+	return 2 * time.Second
+}
+
+// cdcMaxChanges limite le nombre de modifications décodées par interrogation
+// du slot (la limite n'est vérifiée qu'en fin de transaction).
+const cdcMaxChanges = 1000
+
+type cdcWorker struct {
+	stream   CDCStream
+	renderer *renderer
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu     sync.Mutex
+	status StreamStatus
+
+	db   *sql.DB
+	plan scanPlan
+}
+
+func (w *cdcWorker) setError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.LastError = err.Error()
+}
+
+// connect ouvre la connexion et crée si besoin la publication et le slot.
+func (w *cdcWorker) connect(ctx context.Context) error {
+	req := w.stream.Request
+	db, err := OpenDB(ctx, req.ConnParams)
+	if err != nil {
+		return err
+	}
+
+	var walLevel string
+	if err := db.QueryRowContext(ctx, "SHOW wal_level").Scan(&walLevel); err != nil {
+		db.Close()
+		return fmt.Errorf("erreur lecture wal_level: %w", err)
+	}
+	if walLevel != "logical" {
+		db.Close()
+		return fmt.Errorf("wal_level vaut %q, 'logical' est requis pour la réplication logique", walLevel)
+	}
+
+	plan, err := newScanPlan(db, req.TableName)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("erreur récupération clé primaire: %w", err)
+	}
+	if plan.useCtid {
+		db.Close()
+		return fmt.Errorf("la table %s doit avoir une clé primaire pour la réplication logique", req.TableName)
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_publication WHERE pubname = $1)", w.stream.Publication).Scan(&exists); err != nil {
+		db.Close()
+		return fmt.Errorf("erreur lecture publication: %w", err)
+	}
+	if !exists {
+		query := fmt.Sprintf("CREATE PUBLICATION %s FOR TABLE %s",
+			pq.QuoteIdentifier(w.stream.Publication), pq.QuoteIdentifier(req.TableName))
+		if _, err := db.ExecContext(ctx, query); err != nil {
+			db.Close()
+			return fmt.Errorf("erreur création publication: %w", err)
+		}
+	}
+
+	var confirmed sql.NullString
+	err = db.QueryRowContext(ctx, "SELECT confirmed_flush_lsn::text FROM pg_replication_slots WHERE slot_name = $1", w.stream.Slot).Scan(&confirmed)
+	if err == sql.ErrNoRows {
+		err = db.QueryRowContext(ctx, "SELECT lsn::text FROM pg_create_logical_replication_slot($1, 'pgoutput')", w.stream.Slot).Scan(&confirmed)
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("erreur création slot de réplication: %w", err)
+		}
+	} else if err != nil {
+		db.Close()
+		return fmt.Errorf("erreur lecture slot de réplication: %w", err)
+	}
+
+	w.db = db
+	w.plan = plan
+	w.mu.Lock()
+	w.status.ConfirmedLSN = confirmed.String
+	w.status.LastError = ""
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *cdcWorker) run(ctx context.Context) {
+	defer close(w.done)
+	defer func() {
+		if w.db != nil {
+			w.db.Close()
+		}
+		w.mu.Lock()
+		w.status.Running = false
+		w.mu.Unlock()
+	}()
+
+	interval := cdcPollInterval()
+	for {
+		if w.db == nil {
+			if err := w.connect(ctx); err != nil {
+				w.setError(err)
+			}
+		}
+
+		n := 0
+		if w.db != nil {
+			var err error
+			n, err = w.poll(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("CDC %s : %v", w.stream.Source, err)
+				w.setError(err)
+				w.db.Close()
+				w.db = nil
+			}
+		}
+
+		// On enchaîne tant que le slot renvoie des modifications
+		if n > 0 {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// poll décode les transactions en attente sur le slot, applique les
+// modifications à Qdrant puis confirme le LSN traité.
+func (w *cdcWorker) poll(ctx context.Context) (int, error) {
+	req := w.stream.Request
+	rows, err := w.db.QueryContext(ctx, `
+		SELECT lsn::text, data
+		FROM   pg_logical_slot_peek_binary_changes($1, NULL, $2,
+		         'proto_version', '1', 'publication_names', $3)`,
+		w.stream.Slot, cdcMaxChanges, w.stream.Publication)
+	if err != nil {
+		return 0, fmt.Errorf("erreur lecture slot: %w", err)
+	}
+
+	relations := make(map[uint32]*pgRelation)
+	// Dernière opération connue par ligne, dans l'ordre d'apparition
+	ops := make(map[string]byte)
+	keys := make(map[string][]string)
+	var order []string
+	var lastLSN string
+	messages := 0
+
+	record := func(key []string, op byte) {
+		id := DataID(key)
+		if _, seen := ops[id]; !seen {
+			order = append(order, id)
+		}
+		ops[id] = op
+		keys[id] = key
+	}
+
+	for rows.Next() {
+		var lsn string
+		var data []byte
+		if err := rows.Scan(&lsn, &data); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("erreur lecture message: %w", err)
+		}
+		lastLSN = lsn
+		messages++
+
+		rel, change, err := parsePgOutput(data)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("erreur décodage pgoutput: %w", err)
+		}
+		if rel != nil {
+			relations[rel.ID] = rel
+			continue
+		}
+		if change == nil {
+			continue
+		}
+		rel, ok := relations[change.Relation]
+		if !ok || rel.Name != req.TableName {
+			continue
+		}
+
+		switch change.Kind {
+		case 'I', 'U':
+			newKey, ok := tupleKey(rel, change.NewTuple, w.plan.keys)
+			if !ok {
+				continue
+			}
+			// Clé primaire modifiée : l'ancienne ligne disparaît
+			if oldKey, ok := tupleKey(rel, change.OldTuple, w.plan.keys); ok && DataID(oldKey) != DataID(newKey) {
+				record(oldKey, 'D')
+			}
+			record(newKey, 'U')
+		case 'D':
+			if oldKey, ok := tupleKey(rel, change.OldTuple, w.plan.keys); ok {
+				record(oldKey, 'D')
+			}
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("erreur lecture slot: %w", err)
+	}
+	if messages == 0 {
+		return 0, nil
+	}
+
+	var upserts, deletes [][]string
+	for _, id := range order {
+		if ops[id] == 'D' {
+			deletes = append(deletes, keys[id])
+		} else {
+			upserts = append(upserts, keys[id])
+		}
+	}
+
+	upserted, deleted, err := applyChanges(ctx, w.db, w.plan, w.renderer, upserts, deletes, w.stream.Request.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// Confirmer la position : consomme exactement les transactions traitées
+	_, err = w.db.ExecContext(ctx, `
+		SELECT count(*)
+		FROM   pg_logical_slot_get_binary_changes($1, $2::pg_lsn, NULL,
+		         'proto_version', '1', 'publication_names', $3)`,
+		w.stream.Slot, lastLSN, w.stream.Publication)
+	if err != nil {
+		return 0, fmt.Errorf("erreur confirmation LSN: %w", err)
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	w.status.ConfirmedLSN = lastLSN
+	w.status.RowsUpserted += upserted
+	w.status.RowsDeleted += deleted
+	w.status.LastError = ""
+	if upserted+deleted > 0 {
+		w.status.LastEventAt = &now
+	}
+	w.mu.Unlock()
+	return messages, nil
+}
+
+// CDCManager gère les flux de réplication logique actifs.
+type CDCManager struct {
+	mu      sync.Mutex
+	workers map[string]*cdcWorker
+}
+
+func NewCDCManager() *CDCManager {
+	return &CDCManager{workers: make(map[string]*cdcWorker)}
+}
+
+// CDC est le gestionnaire utilisé par les handlers HTTP.
+var CDC = NewCDCManager()
+
+func newCDCWorker(stream CDCStream) (*cdcWorker, error) {
+	r, err := newRenderer(stream.Request, stream.OwnerID)
+	if err != nil {
+		return nil, err
+	}
+	return &cdcWorker{
+		stream:   stream,
+		renderer: r,
+		done:     make(chan struct{}),
+		status: StreamStatus{
+			Source:      stream.Source,
+			Running:     true,
+			Slot:        stream.Slot,
+			Publication: stream.Publication,
+		},
+	}, nil
+}
+
+func (m *CDCManager) spawn(w *cdcWorker) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	m.workers[cdcKey(w.stream.OwnerID, w.stream.Source)] = w
+	go w.run(ctx)
+}
+
+// Start prépare la publication et le slot puis lance le flux. Un flux déjà
+// actif pour la même source est remplacé.
+func (m *CDCManager) Start(ctx context.Context, stream CDCStream) error {
+	if stream.Slot == "" {
+		stream.Slot = DefaultSyncName(stream.OwnerID, stream.Source)
+	}
+	if stream.Publication == "" {
+		stream.Publication = stream.Slot
+	}
+	if !syncNameRe.MatchString(stream.Slot) || !syncNameRe.MatchString(stream.Publication) {
+		return fmt.Errorf("noms de slot et de publication limités à [a-z0-9_], 63 caractères")
+	}
+	stream.Enabled = true
+
+	w, err := newCDCWorker(stream)
+	if err != nil {
+		return err
+	}
+	if err := w.connect(ctx); err != nil {
+		return err
+	}
+
+	store, err := DefaultStore()
+	if err != nil {
+		w.db.Close()
+		return err
+	}
+	if err := store.Put(cdcKey(stream.OwnerID, stream.Source), stream.withoutPassword()); err != nil {
+		w.db.Close()
+		return err
+	}
+	if err := registerConnection(store, stream.OwnerID, stream.Request); err != nil {
+		w.db.Close()
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopLocked(stream.OwnerID, stream.Source)
+	m.spawn(w)
+	return nil
+}
+
+func (m *CDCManager) stopLocked(ownerID, source string) bool {
+	key := cdcKey(ownerID, source)
+	w, ok := m.workers[key]
+	if !ok {
+		return false
+	}
+	w.cancel()
+	<-w.done
+	delete(m.workers, key)
+	return true
+}
+
+// Stop arrête le flux. Sans dropSlot, le slot est conservé (et continue de
+// retenir les WAL) pour reprendre plus tard sans perte ; avec dropSlot, le
+// slot, la publication et l'abonnement sont supprimés.
+func (m *CDCManager) Stop(ctx context.Context, ownerID, source string, dropSlot bool) error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	var stream CDCStream
+	ok, err := store.Get(cdcKey(ownerID, source), &stream)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("aucun flux CDC pour %s", source)
+	}
+
+	m.mu.Lock()
+	m.stopLocked(ownerID, source)
+	m.mu.Unlock()
+
+	if !dropSlot {
+		stream.Enabled = false
+		return store.Put(cdcKey(ownerID, source), stream.withoutPassword())
+	}
+
+	stream, err = stream.withPassword()
+	if err != nil {
+		return err
+	}
+	db, err := OpenDB(ctx, stream.Request.ConnParams)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := db.ExecContext(ctx, "SELECT pg_drop_replication_slot(slot_name) FROM pg_replication_slots WHERE slot_name = $1", stream.Slot); err != nil {
+		return fmt.Errorf("erreur suppression slot: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, "DROP PUBLICATION IF EXISTS "+pq.QuoteIdentifier(stream.Publication)); err != nil {
+		return fmt.Errorf("erreur suppression publication: %w", err)
+	}
+	return store.Delete(cdcKey(ownerID, source))
+}
+
+// Status liste les flux CDC de ownerID, actifs ou arrêtés.
+func (m *CDCManager) Status(ownerID string) ([]StreamStatus, error) {
+	store, err := DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := cdcKey(ownerID, "")
+	statuses := []StreamStatus{}
+	for _, key := range store.Keys(prefix) {
+		m.mu.Lock()
+		w, running := m.workers[key]
+		m.mu.Unlock()
+		if running {
+			w.mu.Lock()
+			statuses = append(statuses, w.status)
+			w.mu.Unlock()
+			continue
+		}
+
+		var stream CDCStream
+		if _, err := store.Get(key, &stream); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, StreamStatus{
+			Source:      stream.Source,
+			Slot:        stream.Slot,
+			Publication: stream.Publication,
+		})
+	}
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].Source < statuses[k].Source
+	})
+	return statuses, nil
+}
+
+// Restore relance les flux actifs enregistrés, typiquement au démarrage.
+func (m *CDCManager) Restore() error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range store.Keys("cdc/") {
+		var stream CDCStream
+		if _, err := store.Get(key, &stream); err != nil {
+			return err
+		}
+		if stream.Request.Password != "" {
+			// État écrit par une version antérieure : réécrit sans mot de passe
+			if err := store.Put(key, stream.withoutPassword()); err != nil {
+				return err
+			}
+		}
+		if !stream.Enabled {
+			continue
+		}
+		stream, err := stream.withPassword()
+		if err != nil {
+			log.Printf("CDC %s non relancé : %v", stream.Source, err)
+			continue
+		}
+		w, err := newCDCWorker(stream)
+		if err != nil {
+			log.Printf("CDC %s non relancé : %v", stream.Source, err)
+			continue
+		}
+		m.spawn(w)
+	}
+	return nil
+}
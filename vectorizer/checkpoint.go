@@ -0,0 +1,52 @@
+package vectorizer
+
+import (
+	"fmt"
+	"time"
+)
+
+// Checkpoint mémorise la dernière clé (primaire ou ctid) envoyée avec succès à Qdrant
+// pour un couple propriétaire / source.
+type Checkpoint struct {
+	OwnerID    string    `json:"owner_id"`
+	Source     string    `json:"source"`
+	KeyColumns []string  `json:"key_columns"`
+	LastKey    []string  `json:"last_key"`
+	Completed  bool      `json:"completed"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func checkpointKey(ownerID, source string) string {
+	return fmt.Sprintf("checkpoint/%s/%s", ownerID, source)
+}
+
+// LoadCheckpoint retourne le checkpoint de ownerID/source s'il existe.
+func LoadCheckpoint(store *Store, ownerID, source string) (*Checkpoint, error) {
+	var cp Checkpoint
+	ok, err := store.Get(checkpointKey(ownerID, source), &cp)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+func saveCheckpoint(store *Store, cp Checkpoint) error {
+	cp.UpdatedAt = time.Now()
+	return store.Put(checkpointKey(cp.OwnerID, cp.Source), cp)
+}
+
+func deleteCheckpoint(store *Store, ownerID, source string) error {
+	return store.Delete(checkpointKey(ownerID, source))
+}
+
+// formatKeyValue convertit une valeur de clé en texte relisible par PostgreSQL.
+func formatKeyValue(v interface{}) string {
+	switch val := v.(type) {
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case []byte:
+		return string(val)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
@@ -0,0 +1,54 @@
+package vectorizer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+)
+
+// Connection mémorise la connexion et la table d'où proviennent les points
+// d'une source, pour pouvoir relire les lignes d'origine après la recherche.
+// Params est persisté sans mot de passe (voir withPassword).
+type Connection struct {
+	OwnerID   string            `json:"owner_id"`
+	Source    string            `json:"source"`
+	Params    models.ConnParams `json:"params"`
+	TableName string            `json:"table_name"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+func connectionKey(ownerID, source string) string {
+	return fmt.Sprintf("connection/%s/%s", ownerID, source)
+}
+
+// LoadConnection retourne la connexion enregistrée pour ownerID/source, sans
+// mot de passe.
+func LoadConnection(store *Store, ownerID, source string) (*Connection, error) {
+	var conn Connection
+	ok, err := store.Get(connectionKey(ownerID, source), &conn)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if conn.Params.Password != "" {
+		// État écrit par une version antérieure : le mot de passe passe en
+		// mémoire et l'entrée est réécrite sans lui
+		conn.Params = withoutPassword(ownerID, conn.Params)
+		if err := store.Put(connectionKey(ownerID, source), conn); err != nil {
+			return nil, err
+		}
+	}
+	return &conn, nil
+}
+
+// registerConnection enregistre la connexion utilisée pour vectoriser req.
+func registerConnection(store *Store, ownerID string, req models.FormatRequest) error {
+	source := Source(req)
+	return store.Put(connectionKey(ownerID, source), Connection{
+		OwnerID:   ownerID,
+		Source:    source,
+		Params:    withoutPassword(ownerID, req.ConnParams),
+		TableName: req.TableName,
+		UpdatedAt: time.Now(),
+	})
+}
@@ -0,0 +1,72 @@
+package vectorizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+)
+
+// Les mots de passe PostgreSQL ne sont jamais écrits dans le store. Les
+// paramètres persistés (connexions, flux CDC, abonnements NOTIFY) en sont
+// dépourvus ; le mot de passe est retrouvé au moment de se connecter, en
+// mémoire s'il a été fourni par une requête depuis le démarrage, sinon dans
+// le fichier de secrets VECTORIZER_DB_PASSWORDS_FILE.
+var passwords = struct {
+	sync.Mutex
+	byKey map[string]string
+}{byKey: make(map[string]string)}
+
+// credentialKey identifie une base : "user@host:port/dbname".
+func credentialKey(p models.ConnParams) string {
+	return fmt.Sprintf("%s@%s:%d/%s", p.User, p.Host, p.Port, p.DBName)
+}
+
+// withoutPassword garde en mémoire, pour ownerID, le mot de passe de p et
+// retourne p sans mot de passe, prêt à être persisté.
+func withoutPassword(ownerID string, p models.ConnParams) models.ConnParams {
+	if p.Password != "" {
+		passwords.Lock()
+		passwords.byKey[ownerID+"/"+credentialKey(p)] = p.Password
+		passwords.Unlock()
+	}
+	p.Password = ""
+	return p
+}
+
+// withPassword complète des paramètres relus dans le store. Le mot de passe
+// vient de la mémoire (fourni par ownerID lui-même) ou du fichier désigné par
+// VECTORIZER_DB_PASSWORDS_FILE, un objet JSON {"user@host:port/dbname": "..."}
+// géré par l'exploitant.
+func withPassword(ownerID string, p models.ConnParams) (models.ConnParams, error) {
+	if p.Password != "" {
+		return p, nil
+	}
+	key := credentialKey(p)
+
+	passwords.Lock()
+	password, ok := passwords.byKey[ownerID+"/"+key]
+	passwords.Unlock()
+	if ok {
+		p.Password = password
+		return p, nil
+	}
+
+	if path := os.Getenv("VECTORIZER_DB_PASSWORDS_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return p, fmt.Errorf("erreur lecture %s : %w", path, err)
+		}
+		var secrets map[string]string
+		if err := json.Unmarshal(content, &secrets); err != nil {
+			return p, fmt.Errorf("erreur parsing %s : %w", path, err)
+		}
+		if password, ok := secrets[key]; ok {
+			p.Password = password
+			return p, nil
+		}
+	}
+	return p, fmt.Errorf("mot de passe inconnu pour %s : renvoyer la requête ou le renseigner dans VECTORIZER_DB_PASSWORDS_FILE", key)
+}
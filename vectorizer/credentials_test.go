@@ -0,0 +1,83 @@
+package vectorizer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+)
+
+func TestRegisterConnectionWithoutPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := models.FormatRequest{TableName: "employee"}
+	req.ConnParams = models.ConnParams{Host: "db", Port: 5432, User: "app", Password: "s3cret", DBName: "rh"}
+
+	if err := registerConnection(store, "owner-a", req); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "s3cret") {
+		t.Fatalf("mot de passe persisté : %s", content)
+	}
+
+	conn, err := LoadConnection(store, "owner-a", Source(req))
+	if err != nil || conn == nil {
+		t.Fatalf("connexion introuvable : %v", err)
+	}
+	if params, err := withPassword("owner-a", conn.Params); err != nil || params.Password != "s3cret" {
+		t.Errorf("mot de passe en mémoire attendu, reçu %q, %v", params.Password, err)
+	}
+	// Le mot de passe d'un autre propriétaire n'est jamais réutilisé
+	if _, err := withPassword("owner-b", conn.Params); err == nil {
+		t.Error("mot de passe de owner-a rendu à owner-b")
+	}
+}
+
+func TestWithPasswordSecretsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passwords.json")
+	if err := os.WriteFile(path, []byte(`{"etl@db:5432/ventes": "depuis-fichier"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("VECTORIZER_DB_PASSWORDS_FILE", path)
+
+	params, err := withPassword("owner-c", models.ConnParams{Host: "db", Port: 5432, User: "etl", DBName: "ventes"})
+	if err != nil || params.Password != "depuis-fichier" {
+		t.Errorf("mot de passe du fichier attendu, reçu %q, %v", params.Password, err)
+	}
+	if _, err := withPassword("owner-c", models.ConnParams{Host: "db", Port: 5432, User: "etl", DBName: "autre"}); err == nil {
+		t.Error("erreur attendue pour une base absente du fichier")
+	}
+}
+
+func TestLoadConnectionMigratesPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	legacy := `{"connection/owner-d/src": {"owner_id": "owner-d", "source": "src", "params": {"host": "db", "port": 5432, "user": "old", "password": "ancien", "dbname": "rh"}}}`
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := LoadConnection(store, "owner-d", "src")
+	if err != nil || conn == nil || conn.Params.Password != "" {
+		t.Fatalf("connexion sans mot de passe attendue, reçu %+v, %v", conn, err)
+	}
+	content, _ := os.ReadFile(path)
+	if strings.Contains(string(content), "ancien") {
+		t.Errorf("état non réécrit : %s", content)
+	}
+	if params, err := withPassword("owner-d", conn.Params); err != nil || params.Password != "ancien" {
+		t.Errorf("mot de passe migré en mémoire attendu, reçu %q, %v", params.Password, err)
+	}
+}
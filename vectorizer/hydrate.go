@@ -0,0 +1,117 @@
+package vectorizer
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+)
+
+// États de réhydratation d'un résultat de recherche
+const (
+	RowFound       = "found"       // ligne relue dans PostgreSQL
+	RowMissing     = "missing"     // la ligne n'existe plus
+	RowUnavailable = "unavailable" // source inconnue ou illisible, voir RowError
+)
+
+// HydrateResults relit dans PostgreSQL la ligne courante de chaque résultat, à
+// partir de son payload source / data_id et de la connexion enregistrée lors
+// de la vectorisation. Les résultats sont complétés en place ; une source
+// illisible n'empêche pas la réhydratation des autres.
+func HydrateResults(ctx context.Context, ownerID string, hits []*utils.SearchResult) error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	bySource := make(map[string][]*utils.SearchResult)
+	for _, hit := range hits {
+		source, _ := hit.Payload["source"].(string)
+		dataID, _ := hit.Payload["data_id"].(string)
+		if source == "" || dataID == "" {
+			markUnavailable([]*utils.SearchResult{hit}, "source ou data_id absent du payload")
+			continue
+		}
+		bySource[source] = append(bySource[source], hit)
+	}
+
+	for source, group := range bySource {
+		conn, err := LoadConnection(store, ownerID, source)
+		if err != nil {
+			return err
+		}
+		if conn == nil {
+			markUnavailable(group, "aucune connexion enregistrée pour "+source)
+			continue
+		}
+		if err := hydrateSource(ctx, ownerID, conn, group); err != nil {
+			markUnavailable(group, err.Error())
+		}
+	}
+	return nil
+}
+
+// hydrateSource relit en une requête les lignes des résultats d'une source.
+func hydrateSource(ctx context.Context, ownerID string, conn *Connection, hits []*utils.SearchResult) error {
+	params, err := withPassword(ownerID, conn.Params)
+	if err != nil {
+		return err
+	}
+	db, err := OpenDB(ctx, params)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	plan, err := newScanPlan(db, conn.TableName)
+	if err != nil {
+		return err
+	}
+
+	var keys [][]string
+	var pending []*utils.SearchResult
+	for _, hit := range hits {
+		key, ok := splitDataID(hit.Payload["data_id"].(string), len(plan.keys))
+		if !ok {
+			markUnavailable([]*utils.SearchResult{hit}, "data_id incompatible avec la clé primaire actuelle")
+			continue
+		}
+		keys = append(keys, key)
+		pending = append(pending, hit)
+	}
+
+	rows, _, err := fetchRowsByKey(ctx, db, plan, keys)
+	if err != nil {
+		return err
+	}
+	for i, hit := range pending {
+		if row, ok := rows[DataID(keys[i])]; ok {
+			hit.Row = row
+			hit.RowStatus = RowFound
+		} else {
+			hit.RowStatus = RowMissing
+		}
+	}
+	return nil
+}
+
+// splitDataID retrouve les valeurs de clé d'un data_id (voir DataID). Une clé
+// simple est prise telle quelle, une clé composite est un tableau JSON.
+func splitDataID(dataID string, keyCount int) ([]string, bool) {
+	if keyCount == 1 {
+		return []string{dataID}, true
+	}
+	var key []string
+	if err := json.Unmarshal([]byte(dataID), &key); err != nil {
+		return nil, false
+	}
+	return key, len(key) == keyCount
+}
+
+func markUnavailable(hits []*utils.SearchResult, reason string) {
+	for _, hit := range hits {
+		hit.Row = nil
+		hit.RowStatus = RowUnavailable
+		hit.RowError = reason
+	}
+}
@@ -0,0 +1,269 @@
+package vectorizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Job suit l'avancement d'une vectorisation lancée en arrière-plan.
+type Job struct {
+	mu sync.Mutex
+
+	id        string
+	ownerID   string
+	source    string
+	status    JobStatus
+	total     int
+	processed int
+	failed    int
+	lastError string
+	batches   []models.BatchReport
+	createdAt time.Time
+	startedAt time.Time
+	endedAt   time.Time
+	cancel    context.CancelFunc
+}
+
+// JobSnapshot est la vue JSON d'un job à un instant donné.
+type JobSnapshot struct {
+	ID            string               `json:"id"`
+	Source        string               `json:"source"`
+	Status        JobStatus            `json:"status"`
+	RowsTotal     int                  `json:"rows_total"`
+	RowsProcessed int                  `json:"rows_processed"`
+	RowsFailed    int                  `json:"rows_failed"`
+	ETASeconds    *float64             `json:"eta_seconds,omitempty"`
+	LastError     string               `json:"last_error,omitempty"`
+	Batches       []models.BatchReport `json:"batches,omitempty"`
+	CreatedAt     time.Time            `json:"created_at"`
+	StartedAt     *time.Time           `json:"started_at,omitempty"`
+	FinishedAt    *time.Time           `json:"finished_at,omitempty"`
+}
+
+func (j *Job) ID() string { return j.id }
+
+func (j *Job) setTotal(total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.total = total
+}
+
+func (j *Job) addBatch(report models.BatchReport) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if report.Error != "" {
+		j.failed += report.Rows
+		j.lastError = report.Error
+	} else {
+		j.processed += report.Rows
+	}
+	j.batches = append(j.batches, report)
+}
+
+func (j *Job) finish(status JobStatus, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = status
+	if err != nil {
+		j.lastError = err.Error()
+	}
+	j.endedAt = time.Now()
+}
+
+// Snapshot retourne une copie cohérente de l'état du job.
+func (j *Job) Snapshot() JobSnapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	snap := JobSnapshot{
+		ID:            j.id,
+		Source:        j.source,
+		Status:        j.status,
+		RowsTotal:     j.total,
+		RowsProcessed: j.processed,
+		RowsFailed:    j.failed,
+		LastError:     j.lastError,
+		Batches:       append([]models.BatchReport(nil), j.batches...),
+		CreatedAt:     j.createdAt,
+	}
+	if !j.startedAt.IsZero() {
+		started := j.startedAt
+		snap.StartedAt = &started
+	}
+	if !j.endedAt.IsZero() {
+		ended := j.endedAt
+		snap.FinishedAt = &ended
+	}
+
+	// Estimation du temps restant à partir du débit observé
+	done := j.processed + j.failed
+	if j.status == JobRunning && done > 0 && j.total > done {
+		elapsed := time.Since(j.startedAt).Seconds()
+		eta := elapsed / float64(done) * float64(j.total-done)
+		snap.ETASeconds = &eta
+	}
+	return snap
+}
+
+// finishedJobTTL est la durée pendant laquelle un job terminé reste consultable.
+const finishedJobTTL = time.Hour
+
+// defaultMaxJobs est le nombre de jobs exécutés simultanément si
+// VECTORIZER_MAX_JOBS n'est pas défini.
+const defaultMaxJobs = 4
+
+func maxJobs() int {
+	if n, err := strconv.Atoi(os.Getenv("VECTORIZER_MAX_JOBS")); err == nil && n > 0 {
+		return n
+	}
+	return defaultMaxJobs
+}
+
+// Manager conserve en mémoire les jobs de vectorisation. Les jobs terminés
+// sont oubliés après ttl. Au plus cap(slots) jobs s'exécutent en même temps ;
+// les suivants attendent une place avec le statut pending.
+type Manager struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	ttl   time.Duration
+	slots chan struct{}
+}
+
+func NewManager() *Manager {
+	return &Manager{jobs: make(map[string]*Job), ttl: finishedJobTTL, slots: make(chan struct{}, maxJobs())}
+}
+
+// pruneLocked retire les jobs terminés depuis plus de ttl. m.mu doit être tenu.
+func (m *Manager) pruneLocked() {
+	now := time.Now()
+	for id, job := range m.jobs {
+		job.mu.Lock()
+		expired := !job.endedAt.IsZero() && now.Sub(job.endedAt) > m.ttl
+		job.mu.Unlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// Jobs est le gestionnaire utilisé par les handlers HTTP.
+var Jobs = NewManager()
+
+// Submit enregistre un job pour ownerID et lance run dans une goroutine dès
+// qu'une place d'exécution se libère.
+func (m *Manager) Submit(ownerID, source string, run func(ctx context.Context, job *Job) error) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &Job{
+		id:        uuid.New().String(),
+		ownerID:   ownerID,
+		source:    source,
+		status:    JobPending,
+		createdAt: time.Now(),
+		cancel:    cancel,
+	}
+
+	m.mu.Lock()
+	m.pruneLocked()
+	m.jobs[job.id] = job
+	m.mu.Unlock()
+
+	go func() {
+		defer cancel()
+
+		// Un job annulé pendant l'attente ne démarre pas
+		select {
+		case m.slots <- struct{}{}:
+			defer func() { <-m.slots }()
+		case <-ctx.Done():
+			job.finish(JobCancelled, nil)
+			return
+		}
+
+		job.mu.Lock()
+		job.status = JobRunning
+		job.startedAt = time.Now()
+		job.mu.Unlock()
+
+		err := run(ctx, job)
+		switch {
+		case ctx.Err() != nil:
+			job.finish(JobCancelled, nil)
+		case err != nil:
+			job.finish(JobFailed, err)
+		default:
+			job.finish(JobCompleted, nil)
+		}
+	}()
+
+	return job
+}
+
+// Get retourne le job s'il appartient à ownerID.
+func (m *Manager) Get(ownerID, id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked()
+	job, ok := m.jobs[id]
+	if !ok || job.ownerID != ownerID {
+		return nil, false
+	}
+	return job, true
+}
+
+// List retourne les jobs de ownerID, du plus récent au plus ancien.
+func (m *Manager) List(ownerID string) []JobSnapshot {
+	m.mu.Lock()
+	m.pruneLocked()
+	var jobs []*Job
+	for _, job := range m.jobs {
+		if job.ownerID == ownerID {
+			jobs = append(jobs, job)
+		}
+	}
+	m.mu.Unlock()
+
+	snaps := make([]JobSnapshot, 0, len(jobs))
+	for _, job := range jobs {
+		snaps = append(snaps, job.Snapshot())
+	}
+	sort.Slice(snaps, func(i, k int) bool {
+		return snaps[i].CreatedAt.After(snaps[k].CreatedAt)
+	})
+	return snaps
+}
+
+// Cancel demande l'arrêt d'un job en cours.
+func (m *Manager) Cancel(ownerID, id string) error {
+	job, ok := m.Get(ownerID, id)
+	if !ok {
+		return fmt.Errorf("job %s introuvable", id)
+	}
+
+	job.mu.Lock()
+	status := job.status
+	job.mu.Unlock()
+	if status != JobPending && status != JobRunning {
+		return fmt.Errorf("job %s déjà terminé (%s)", id, status)
+	}
+
+	job.cancel()
+	return nil
+}
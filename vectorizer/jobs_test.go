@@ -0,0 +1,52 @@
+package vectorizer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitStatus attend que job atteigne status.
+func waitStatus(t *testing.T, job *Job, status JobStatus) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for job.Snapshot().Status != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s : statut %s, attendu %s", job.ID(), job.Snapshot().Status, status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestManagerMaxJobs(t *testing.T) {
+	t.Setenv("VECTORIZER_MAX_JOBS", "1")
+	m := NewManager()
+
+	release := make(chan struct{})
+	blocking := func(ctx context.Context, job *Job) error {
+		<-release
+		return nil
+	}
+	first := m.Submit("owner", "db/a", blocking)
+	waitStatus(t, first, JobRunning)
+
+	second := m.Submit("owner", "db/b", blocking)
+	third := m.Submit("owner", "db/c", blocking)
+	time.Sleep(20 * time.Millisecond)
+	if s := second.Snapshot(); s.Status != JobPending || s.StartedAt != nil {
+		t.Fatalf("second job démarré sans place libre : %+v", s)
+	}
+
+	// Un job annulé en attente se termine sans s'exécuter
+	if err := m.Cancel("owner", third.ID()); err != nil {
+		t.Fatal(err)
+	}
+	waitStatus(t, third, JobCancelled)
+	if third.Snapshot().StartedAt != nil {
+		t.Error("job annulé en attente marqué comme démarré")
+	}
+
+	close(release)
+	waitStatus(t, first, JobCompleted)
+	waitStatus(t, second, JobCompleted)
+}
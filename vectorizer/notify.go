@@ -0,0 +1,527 @@
+package vectorizer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/lib/pq"
+)
+
+// NotifySubscription est l'abonnement persisté d'une table via un trigger
+// qui publie les clés modifiées par pg_notify. C'est l'alternative à la
+// réplication logique pour les instances qui n'autorisent pas les slots.
+// Request est persisté sans mot de passe (voir withPassword).
+type NotifySubscription struct {
+	OwnerID string               `json:"owner_id"`
+	Source  string               `json:"source"`
+	Request models.FormatRequest `json:"request"`
+	Channel string               `json:"channel"`
+	KeyCols []string             `json:"key_columns"`
+}
+
+// withoutPassword retourne l'abonnement tel qu'il est persisté, sans mot de passe.
+func (s NotifySubscription) withoutPassword() NotifySubscription {
+	s.Request.ConnParams = withoutPassword(s.OwnerID, s.Request.ConnParams)
+	return s
+}
+
+// withPassword complète un abonnement relu dans le store avec son mot de passe.
+func (s NotifySubscription) withPassword() (NotifySubscription, error) {
+	params, err := withPassword(s.OwnerID, s.Request.ConnParams)
+	s.Request.ConnParams = params
+	return s, err
+}
+
+// notifyPayload est le message émis par le trigger.
+type notifyPayload struct {
+	Op   string   `json:"op"`
+	Keys []string `json:"keys"`
+}
+
+const (
+	// notifyBatchSize et notifyBatchWait regroupent les notifications
+	// rapprochées en un seul appel à l'embedder.
+	notifyBatchSize = 200
+	notifyBatchWait = 500 * time.Millisecond
+	// Un lot en échec est gardé et réessayé avec un délai croissant jusqu'à
+	// notifyRetryMax ; au-delà de notifyMaxPending notifications en attente,
+	// il est abandonné au profit d'une resynchronisation.
+	notifyRetryMax   = time.Minute
+	notifyMaxPending = 100 * notifyBatchSize
+)
+
+func notifyKey(ownerID, source string) string {
+	return fmt.Sprintf("notify/%s/%s", ownerID, source)
+}
+
+// notifyTriggerSQL génère la fonction et le trigger qui notifient channel.
+// Une mise à jour qui change la clé primaire émet aussi la suppression de
+// l'ancienne clé.
+func notifyTriggerSQL(table, channel string, keys []string) string {
+	oldVals := make([]string, len(keys))
+	newVals := make([]string, len(keys))
+	oldTexts := make([]string, len(keys))
+	newTexts := make([]string, len(keys))
+	for i, k := range keys {
+		oldVals[i] = "OLD." + pq.QuoteIdentifier(k)
+		newVals[i] = "NEW." + pq.QuoteIdentifier(k)
+		oldTexts[i] = keyText(oldVals[i])
+		newTexts[i] = keyText(newVals[i])
+	}
+	oldKeys := strings.Join(oldTexts, ", ")
+	newKeys := strings.Join(newTexts, ", ")
+	fn := pq.QuoteIdentifier(channel)
+	ch := pq.QuoteLiteral(channel)
+
+	return fmt.Sprintf(`
+CREATE OR REPLACE FUNCTION %[1]s() RETURNS trigger LANGUAGE plpgsql AS $fn$
+BEGIN
+	IF TG_OP = 'DELETE' THEN
+		PERFORM pg_notify(%[2]s, json_build_object('op', 'DELETE', 'keys', json_build_array(%[3]s))::text);
+	ELSIF TG_OP = 'UPDATE' AND (%[5]s) IS DISTINCT FROM (%[6]s) THEN
+		PERFORM pg_notify(%[2]s, json_build_object('op', 'DELETE', 'keys', json_build_array(%[3]s))::text);
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		PERFORM pg_notify(%[2]s, json_build_object('op', TG_OP, 'keys', json_build_array(%[4]s))::text);
+	END IF;
+	RETURN NULL;
+END
+$fn$;
+
+DROP TRIGGER IF EXISTS %[1]s ON %[7]s;
+CREATE TRIGGER %[1]s AFTER INSERT OR UPDATE OR DELETE ON %[7]s
+	FOR EACH ROW EXECUTE FUNCTION %[1]s();
+`, fn, ch, oldKeys, newKeys, strings.Join(oldVals, ", "), strings.Join(newVals, ", "), pq.QuoteIdentifier(table))
+}
+
+type notifyWorker struct {
+	sub      NotifySubscription
+	renderer *renderer
+	plan     scanPlan
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	mu     sync.Mutex
+	status StreamStatus
+}
+
+func (w *notifyWorker) setError(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.LastError = err.Error()
+}
+
+func (w *notifyWorker) setRunning(running bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status.Running = running
+}
+
+func (w *notifyWorker) run(ctx context.Context) {
+	defer close(w.done)
+	defer w.setRunning(false)
+
+	listener := pq.NewListener(connString(w.sub.Request.ConnParams), 10*time.Second, time.Minute,
+		func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("LISTEN %s : %v", w.sub.Source, err)
+				w.setError(err)
+			}
+			switch ev {
+			case pq.ListenerEventDisconnected:
+				w.setRunning(false)
+			case pq.ListenerEventReconnected:
+				w.setRunning(true)
+			}
+		})
+	// Close débloque aussi un Listen en attente de connexion
+	defer listener.Close()
+
+	if !w.listen(ctx, listener) {
+		return
+	}
+
+	// Une seule base par abonnement, réutilisée à chaque lot
+	db, err := sql.Open("postgres", connString(w.sub.Request.ConnParams))
+	if err != nil {
+		w.setError(err)
+		return
+	}
+	defer db.Close()
+
+	ping := time.NewTicker(90 * time.Second)
+	defer ping.Stop()
+
+	var queue notifyQueue
+	var flushTimer <-chan time.Time
+
+	flush := func() {
+		flushTimer = nil
+		retryIn, abandoned, err := queue.flush(func(batch []notifyPayload) error {
+			return w.apply(ctx, db, batch)
+		})
+		switch {
+		case err == nil || ctx.Err() != nil:
+		case abandoned:
+			log.Printf("NOTIFY %s : %v", w.sub.Source, err)
+			w.resync(fmt.Sprintf("notifications abandonnées après échecs (%v)", err))
+		default:
+			log.Printf("NOTIFY %s : %v", w.sub.Source, err)
+			w.setError(fmt.Errorf("mise à jour en échec, nouvel essai dans %s : %w", retryIn, err))
+			flushTimer = time.After(retryIn)
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n := <-listener.Notify:
+			// n == nil : connexion rétablie, les notifications émises pendant
+			// la coupure sont perdues
+			if n == nil {
+				w.resync("connexion LISTEN rétablie")
+				continue
+			}
+			var payload notifyPayload
+			if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+				w.setError(fmt.Errorf("notification invalide: %w", err))
+				continue
+			}
+			queue.pending = append(queue.pending, payload)
+			// En attente d'un nouvel essai, le lot grossit jusqu'à celui-ci
+			if len(queue.pending) >= notifyBatchSize && queue.retry == 0 {
+				flush()
+			} else if flushTimer == nil {
+				flushTimer = time.After(notifyBatchWait)
+			}
+		case <-flushTimer:
+			flush()
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
+
+// notifyQueue garde les notifications reçues jusqu'à leur application : un
+// lot en échec est conservé et réessayé avec un délai croissant.
+type notifyQueue struct {
+	pending []notifyPayload
+	retry   time.Duration // délai du prochain essai, 0 si le dernier a réussi
+}
+
+// flush applique les notifications en attente. En cas d'échec, elles sont
+// gardées et retryIn donne le délai avant le nouvel essai, sauf au-delà de
+// notifyMaxPending où elles sont abandonnées (abandoned).
+func (q *notifyQueue) flush(apply func([]notifyPayload) error) (retryIn time.Duration, abandoned bool, err error) {
+	if len(q.pending) == 0 {
+		return 0, false, nil
+	}
+	if err = apply(q.pending); err == nil {
+		q.pending, q.retry = nil, 0
+		return 0, false, nil
+	}
+	if len(q.pending) >= notifyMaxPending {
+		q.pending, q.retry = nil, 0
+		return 0, true, err
+	}
+	q.retry = min(max(2*q.retry, time.Second), notifyRetryMax)
+	return q.retry, false, err
+}
+
+// listen s'abonne au canal en réessayant avec un délai croissant. Listen
+// bloque tant que la connexion n'est pas établie : l'appel tourne dans une
+// goroutine pour que l'annulation de ctx n'ait pas à l'attendre. Retourne
+// false si ctx est annulé avant.
+func (w *notifyWorker) listen(ctx context.Context, listener *pq.Listener) bool {
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		result := make(chan error, 1)
+		go func() { result <- listener.Listen(w.sub.Channel) }()
+
+		var err error
+		select {
+		case <-ctx.Done():
+			return false
+		case err = <-result:
+		}
+		if err == nil || errors.Is(err, pq.ErrChannelAlreadyOpen) {
+			w.setRunning(true)
+			if attempt > 0 {
+				w.resync("écoute établie après plusieurs tentatives")
+			}
+			return true
+		}
+
+		w.setError(fmt.Errorf("erreur LISTEN %s (nouvel essai dans %s): %w", w.sub.Channel, delay, err))
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, time.Minute)
+	}
+}
+
+// resync rattrape les modifications perdues pendant une coupure de l'écoute :
+// une synchronisation par watermark si la source en a une (les suppressions
+// restent manquées), sinon le statut signale qu'une resynchronisation
+// complète est nécessaire.
+func (w *notifyWorker) resync(reason string) {
+	req := w.sub.Request
+	if req.WatermarkColumn == "" {
+		w.mu.Lock()
+		w.status.ResyncNeeded = true
+		w.status.LastError = reason + " : des modifications ont pu être perdues, relancer une vectorisation complète"
+		w.mu.Unlock()
+		return
+	}
+
+	req.Mode = ModeSync
+	job := Jobs.Submit(w.sub.OwnerID, w.sub.Source, func(ctx context.Context, job *Job) error {
+		return RunStatic(ctx, job, req, w.sub.OwnerID)
+	})
+	log.Printf("NOTIFY %s : %s, synchronisation %s lancée", w.sub.Source, reason, job.ID())
+}
+
+// apply relit les lignes notifiées et met à jour Qdrant.
+func (w *notifyWorker) apply(ctx context.Context, db *sql.DB, batch []notifyPayload) error {
+	// Dernière opération connue par ligne, dans l'ordre d'apparition
+	ops := make(map[string]string)
+	keys := make(map[string][]string)
+	var order []string
+	for _, p := range batch {
+		if len(p.Keys) != len(w.plan.keys) {
+			continue
+		}
+		id := DataID(p.Keys)
+		if _, seen := ops[id]; !seen {
+			order = append(order, id)
+		}
+		ops[id] = p.Op
+		keys[id] = p.Keys
+	}
+
+	var upserts, deletes [][]string
+	for _, id := range order {
+		if ops[id] == "DELETE" {
+			deletes = append(deletes, keys[id])
+		} else {
+			upserts = append(upserts, keys[id])
+		}
+	}
+
+	upserted, deleted, err := applyChanges(ctx, db, w.plan, w.renderer, upserts, deletes, w.sub.Request.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	w.mu.Lock()
+	w.status.RowsUpserted += upserted
+	w.status.RowsDeleted += deleted
+	w.status.LastError = ""
+	w.status.LastEventAt = &now
+	w.mu.Unlock()
+	return nil
+}
+
+// NotifyManager gère les abonnements LISTEN/NOTIFY actifs.
+type NotifyManager struct {
+	mu      sync.Mutex
+	workers map[string]*notifyWorker
+}
+
+func NewNotifyManager() *NotifyManager {
+	return &NotifyManager{workers: make(map[string]*notifyWorker)}
+}
+
+// Notify est le gestionnaire utilisé par les handlers HTTP.
+var Notify = NewNotifyManager()
+
+func (m *NotifyManager) spawn(sub NotifySubscription) error {
+	r, err := newRenderer(sub.Request, sub.OwnerID)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &notifyWorker{
+		sub:      sub,
+		renderer: r,
+		plan:     scanPlan{table: sub.Request.TableName, keys: sub.KeyCols},
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		status:   StreamStatus{Source: sub.Source, Channel: sub.Channel},
+	}
+	m.workers[notifyKey(sub.OwnerID, sub.Source)] = w
+	go w.run(ctx)
+	return nil
+}
+
+func (m *NotifyManager) stopLocked(ownerID, source string) {
+	key := notifyKey(ownerID, source)
+	if w, ok := m.workers[key]; ok {
+		w.cancel()
+		<-w.done
+		delete(m.workers, key)
+	}
+}
+
+// Install crée la fonction et le trigger de notification sur la table puis
+// démarre l'écoute du canal.
+func (m *NotifyManager) Install(ctx context.Context, ownerID string, req models.FormatRequest) (NotifySubscription, error) {
+	source := Source(req)
+	sub := NotifySubscription{
+		OwnerID: ownerID,
+		Source:  source,
+		Request: req,
+		Channel: DefaultSyncName(ownerID, source),
+	}
+
+	db, err := OpenDB(ctx, req.ConnParams)
+	if err != nil {
+		return sub, err
+	}
+	defer db.Close()
+
+	plan, err := newScanPlan(db, req.TableName)
+	if err != nil {
+		return sub, fmt.Errorf("erreur récupération clé primaire: %w", err)
+	}
+	if plan.useCtid {
+		return sub, fmt.Errorf("la table %s doit avoir une clé primaire pour être synchronisée", req.TableName)
+	}
+	sub.KeyCols = plan.keys
+
+	if _, err := db.ExecContext(ctx, notifyTriggerSQL(req.TableName, sub.Channel, plan.keys)); err != nil {
+		return sub, fmt.Errorf("erreur installation trigger: %w", err)
+	}
+
+	store, err := DefaultStore()
+	if err != nil {
+		return sub, err
+	}
+	if err := store.Put(notifyKey(ownerID, source), sub.withoutPassword()); err != nil {
+		return sub, err
+	}
+	if err := registerConnection(store, ownerID, req); err != nil {
+		return sub, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopLocked(ownerID, source)
+	return sub, m.spawn(sub)
+}
+
+// Uninstall arrête l'écoute et supprime le trigger et sa fonction.
+func (m *NotifyManager) Uninstall(ctx context.Context, ownerID, source string) error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	var sub NotifySubscription
+	ok, err := store.Get(notifyKey(ownerID, source), &sub)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("aucun trigger de synchronisation pour %s", source)
+	}
+
+	m.mu.Lock()
+	m.stopLocked(ownerID, source)
+	m.mu.Unlock()
+
+	sub, err = sub.withPassword()
+	if err != nil {
+		return err
+	}
+	db, err := OpenDB(ctx, sub.Request.ConnParams)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	name := pq.QuoteIdentifier(sub.Channel)
+	query := fmt.Sprintf("DROP TRIGGER IF EXISTS %s ON %s; DROP FUNCTION IF EXISTS %s();",
+		name, pq.QuoteIdentifier(sub.Request.TableName), name)
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("erreur suppression trigger: %w", err)
+	}
+	return store.Delete(notifyKey(ownerID, source))
+}
+
+// Status liste les abonnements LISTEN/NOTIFY de ownerID.
+func (m *NotifyManager) Status(ownerID string) ([]StreamStatus, error) {
+	store, err := DefaultStore()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []StreamStatus{}
+	for _, key := range store.Keys(notifyKey(ownerID, "")) {
+		m.mu.Lock()
+		w, running := m.workers[key]
+		m.mu.Unlock()
+		if running {
+			w.mu.Lock()
+			statuses = append(statuses, w.status)
+			w.mu.Unlock()
+			continue
+		}
+
+		var sub NotifySubscription
+		if _, err := store.Get(key, &sub); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, StreamStatus{Source: sub.Source, Channel: sub.Channel})
+	}
+	sort.Slice(statuses, func(i, k int) bool {
+		return statuses[i].Source < statuses[k].Source
+	})
+	return statuses, nil
+}
+
+// Restore relance l'écoute des abonnements enregistrés, typiquement au démarrage.
+func (m *NotifyManager) Restore() error {
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range store.Keys("notify/") {
+		var sub NotifySubscription
+		if _, err := store.Get(key, &sub); err != nil {
+			return err
+		}
+		if sub.Request.Password != "" {
+			// État écrit par une version antérieure : réécrit sans mot de passe
+			if err := store.Put(key, sub.withoutPassword()); err != nil {
+				return err
+			}
+		}
+		sub, err := sub.withPassword()
+		if err != nil {
+			log.Printf("NOTIFY %s non relancé : %v", sub.Source, err)
+			continue
+		}
+		if err := m.spawn(sub); err != nil {
+			log.Printf("NOTIFY %s non relancé : %v", sub.Source, err)
+		}
+	}
+	return nil
+}
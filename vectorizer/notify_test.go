@@ -0,0 +1,61 @@
+package vectorizer
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Un lot en échec est gardé, complété par les notifications suivantes et
+// réessayé avec un délai croissant.
+func TestNotifyQueueRetry(t *testing.T) {
+	var q notifyQueue
+	q.pending = []notifyPayload{{Op: "UPDATE", Keys: []string{"1"}}}
+
+	failures := 3
+	var applied [][]notifyPayload
+	apply := func(batch []notifyPayload) error {
+		applied = append(applied, batch)
+		if failures > 0 {
+			failures--
+			return errors.New("qdrant indisponible")
+		}
+		return nil
+	}
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		retryIn, abandoned, err := q.flush(apply)
+		if err == nil || abandoned || retryIn != want {
+			t.Fatalf("nouvel essai dans %s attendu, reçu %s (abandon %v, err %v)", want, retryIn, abandoned, err)
+		}
+		q.pending = append(q.pending, notifyPayload{Op: "UPDATE", Keys: []string{"2"}})
+	}
+
+	if _, _, err := q.flush(apply); err != nil {
+		t.Fatal(err)
+	}
+	if len(q.pending) != 0 || q.retry != 0 {
+		t.Errorf("file non vidée : %+v", q)
+	}
+	if last := applied[len(applied)-1]; len(last) != 4 || last[0].Keys[0] != "1" {
+		t.Errorf("le dernier essai doit reprendre tout le lot, reçu %+v", last)
+	}
+}
+
+func TestNotifyQueueRetryMax(t *testing.T) {
+	q := notifyQueue{pending: []notifyPayload{{}}, retry: notifyRetryMax}
+	retryIn, _, _ := q.flush(func([]notifyPayload) error { return errors.New("échec") })
+	if retryIn != notifyRetryMax {
+		t.Errorf("délai plafonné à %s attendu, reçu %s", notifyRetryMax, retryIn)
+	}
+}
+
+// Au-delà de notifyMaxPending, le lot est abandonné (une resynchronisation
+// prend le relais) au lieu de grossir sans fin.
+func TestNotifyQueueAbandon(t *testing.T) {
+	q := notifyQueue{pending: make([]notifyPayload, notifyMaxPending)}
+	_, abandoned, err := q.flush(func([]notifyPayload) error { return errors.New("échec") })
+	if !abandoned || err == nil || len(q.pending) != 0 {
+		t.Errorf("abandon attendu : abandoned=%v err=%v en attente=%d", abandoned, err, len(q.pending))
+	}
+}
@@ -0,0 +1,206 @@
+package vectorizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Décodage minimal du protocole logique pgoutput (version 1) tel que renvoyé
+// par pg_logical_slot_peek_binary_changes : un message par ligne.
+
+type pgRelation struct {
+	ID        uint32
+	Namespace string
+	Name      string
+	Columns   []pgRelationColumn
+}
+
+type pgRelationColumn struct {
+	Name  string
+	IsKey bool
+}
+
+// pgChange est une modification de ligne décodée.
+type pgChange struct {
+	Kind     byte // 'I', 'U' ou 'D'
+	Relation uint32
+	OldTuple []pgTupleValue // clé (ou ligne complète) avant modification, si fournie
+	NewTuple []pgTupleValue
+}
+
+type pgTupleValue struct {
+	Kind byte // 'n' null, 'u' TOAST inchangé, 't' texte
+	Data string
+}
+
+type pgReader struct {
+	buf *bytes.Reader
+}
+
+func (r *pgReader) byte() (byte, error) {
+	return r.buf.ReadByte()
+}
+
+func (r *pgReader) int16() (int16, error) {
+	var v int16
+	err := binary.Read(r.buf, binary.BigEndian, &v)
+	return v, err
+}
+
+func (r *pgReader) int32() (int32, error) {
+	var v int32
+	err := binary.Read(r.buf, binary.BigEndian, &v)
+	return v, err
+}
+
+func (r *pgReader) string() (string, error) {
+	var b []byte
+	for {
+		c, err := r.buf.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == 0 {
+			return string(b), nil
+		}
+		b = append(b, c)
+	}
+}
+
+func (r *pgReader) tuple() ([]pgTupleValue, error) {
+	n, err := r.int16()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]pgTupleValue, n)
+	for i := range values {
+		kind, err := r.byte()
+		if err != nil {
+			return nil, err
+		}
+		values[i].Kind = kind
+		switch kind {
+		case 'n', 'u':
+		case 't', 'b':
+			length, err := r.int32()
+			if err != nil {
+				return nil, err
+			}
+			data := make([]byte, length)
+			if _, err := io.ReadFull(r.buf, data); err != nil {
+				return nil, err
+			}
+			values[i].Data = string(data)
+		default:
+			return nil, fmt.Errorf("type de colonne pgoutput inconnu : %q", kind)
+		}
+	}
+	return values, nil
+}
+
+// parsePgOutput décode un message pgoutput. Seuls les messages Relation et
+// Insert/Update/Delete sont retournés, les autres sont ignorés (nil, nil).
+func parsePgOutput(msg []byte) (*pgRelation, *pgChange, error) {
+	if len(msg) == 0 {
+		return nil, nil, nil
+	}
+	r := &pgReader{buf: bytes.NewReader(msg[1:])}
+
+	switch msg[0] {
+	case 'R':
+		id, err := r.int32()
+		if err != nil {
+			return nil, nil, err
+		}
+		rel := &pgRelation{ID: uint32(id)}
+		if rel.Namespace, err = r.string(); err != nil {
+			return nil, nil, err
+		}
+		if rel.Name, err = r.string(); err != nil {
+			return nil, nil, err
+		}
+		if _, err := r.byte(); err != nil { // replica identity
+			return nil, nil, err
+		}
+		n, err := r.int16()
+		if err != nil {
+			return nil, nil, err
+		}
+		for i := 0; i < int(n); i++ {
+			flags, err := r.byte()
+			if err != nil {
+				return nil, nil, err
+			}
+			name, err := r.string()
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, err := r.int32(); err != nil { // oid du type
+				return nil, nil, err
+			}
+			if _, err := r.int32(); err != nil { // typmod
+				return nil, nil, err
+			}
+			rel.Columns = append(rel.Columns, pgRelationColumn{Name: name, IsKey: flags&1 == 1})
+		}
+		return rel, nil, nil
+
+	case 'I', 'U', 'D':
+		id, err := r.int32()
+		if err != nil {
+			return nil, nil, err
+		}
+		change := &pgChange{Kind: msg[0], Relation: uint32(id)}
+		for {
+			marker, err := r.byte()
+			if err != nil {
+				return nil, nil, err
+			}
+			tuple, err := r.tuple()
+			if err != nil {
+				return nil, nil, err
+			}
+			switch marker {
+			case 'K', 'O':
+				change.OldTuple = tuple
+				if change.Kind == 'D' {
+					return nil, change, nil
+				}
+			case 'N':
+				change.NewTuple = tuple
+				return nil, change, nil
+			default:
+				return nil, nil, fmt.Errorf("marqueur de tuple pgoutput inconnu : %q", marker)
+			}
+		}
+
+	default:
+		// Begin, Commit, Origin, Type, Truncate, Message...
+		return nil, nil, nil
+	}
+}
+
+// tupleKey extrait les valeurs des colonnes keys d'un tuple de rel.
+// ok vaut false si une colonne de clé est absente ou nulle.
+func tupleKey(rel *pgRelation, tuple []pgTupleValue, keys []string) ([]string, bool) {
+	if tuple == nil {
+		return nil, false
+	}
+	key := make([]string, len(keys))
+	for i, k := range keys {
+		found := false
+		for j, col := range rel.Columns {
+			if col.Name == k && j < len(tuple) && tuple[j].Kind == 't' {
+				key[i] = tuple[j].Data
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return key, true
+}
@@ -0,0 +1,237 @@
+package vectorizer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+	"github.com/lib/pq"
+)
+
+// columnTypes retourne le type PostgreSQL (INT4, NUMERIC, TIMESTAMPTZ...)
+// de chaque colonne du résultat.
+func columnTypes(rows *sql.Rows) (map[string]string, error) {
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("erreur récupération types de colonnes: %w", err)
+	}
+	types := make(map[string]string, len(cts))
+	for _, ct := range cts {
+		types[ct.Name()] = ct.DatabaseTypeName()
+	}
+	return types, nil
+}
+
+// fetchRowsByKey relit les lignes dont la clé primaire figure dans keys.
+// Le résultat est indexé par DataID du texte des clés relues, comparable à
+// celui des clés reçues ; une clé absente correspond à une ligne supprimée
+// entre-temps.
+func fetchRowsByKey(ctx context.Context, db *sql.DB, plan scanPlan, keys [][]string) (map[string]map[string]interface{}, map[string]string, error) {
+	result := make(map[string]map[string]interface{})
+	if len(keys) == 0 {
+		return result, nil, nil
+	}
+	if plan.useCtid {
+		return nil, nil, fmt.Errorf("la table %s n'a pas de clé primaire", plan.table)
+	}
+
+	tuples := make([]string, len(keys))
+	var args []interface{}
+	for i, key := range keys {
+		placeholders := make([]string, len(key))
+		for j, v := range key {
+			args = append(args, v)
+			placeholders[j] = fmt.Sprintf("$%d", len(args))
+		}
+		tuples[i] = "(" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s IN (%s)",
+		plan.selectList(), pq.QuoteIdentifier(plan.table), plan.keyExpr(), strings.Join(tuples, ", "))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("erreur lecture lignes modifiées: %w", err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, fmt.Errorf("erreur récupération colonnes: %w", err)
+	}
+	types, err := columnTypes(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	for rows.Next() {
+		data, err := scanRow(rows, cols)
+		if err != nil {
+			return nil, nil, fmt.Errorf("erreur scan ligne: %w", err)
+		}
+		result[DataID(plan.rowKey(data))] = data
+	}
+	return result, types, rows.Err()
+}
+
+// renderer transforme les lignes d'une source en documents pour Qdrant.
+type renderer struct {
+	tmpl           *template.Template
+	source         string
+	ownerID        string
+	payloadColumns []string
+	indexed        bool
+}
+
+func newRenderer(req models.FormatRequest, ownerID string) (*renderer, error) {
+	tmpl, err := template.New("line").Parse(req.Template)
+	if err != nil {
+		return nil, fmt.Errorf("erreur parsing template: %w", err)
+	}
+	return &renderer{
+		tmpl:           tmpl,
+		source:         Source(req),
+		ownerID:        ownerID,
+		payloadColumns: req.PayloadColumns,
+	}, nil
+}
+
+// document applique le template à une ligne et copie les colonnes choisies
+// dans le payload.
+func (r *renderer) document(data map[string]interface{}, types map[string]string, dataID string) (utils.Document, error) {
+	var buf strings.Builder
+	if err := r.tmpl.Execute(&buf, data); err != nil {
+		return utils.Document{}, fmt.Errorf("erreur exécution template: %w", err)
+	}
+
+	doc := utils.Document{
+		Text:    buf.String(),
+		Source:  r.source,
+		OwnerID: r.ownerID,
+		DataID:  dataID,
+	}
+	if len(r.payloadColumns) > 0 {
+		doc.Fields = make(map[string]interface{}, len(r.payloadColumns))
+		for _, col := range r.payloadColumns {
+			v, ok := data[col]
+			if !ok {
+				return utils.Document{}, fmt.Errorf("colonne %s introuvable pour le payload", col)
+			}
+			doc.Fields[col] = payloadValue(v, types[col])
+		}
+	}
+	return doc, nil
+}
+
+// ensureIndexes crée, une seule fois, les index Qdrant des colonnes copiées
+// dans le payload en fonction de leur type PostgreSQL.
+func (r *renderer) ensureIndexes(types map[string]string) error {
+	if r.indexed || len(r.payloadColumns) == 0 {
+		return nil
+	}
+	fields := make([]utils.FilteredField, len(r.payloadColumns))
+	for i, col := range r.payloadColumns {
+		fields[i] = utils.FilteredField{
+			Name: utils.FieldsPayloadKey + "." + col,
+			Type: utils.PostgresFieldType(types[col]),
+		}
+	}
+	if err := utils.EnsurePayloadIndexes(fields); err != nil {
+		return err
+	}
+	r.indexed = true
+	return nil
+}
+
+// payloadValue convertit une valeur lue par lib/pq en valeur de payload
+// filtrable (les NUMERIC arrivent sous forme de texte).
+func payloadValue(v interface{}, dbType string) interface{} {
+	switch val := v.(type) {
+	case nil, bool, int64, float64:
+		return val
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case string:
+		if dbType == "NUMERIC" {
+			if f, err := strconv.ParseFloat(val, 64); err == nil {
+				return f
+			}
+		}
+		return val
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// defaultChangeBatchSize est la taille des lots d'applyChanges quand la
+// requête n'en précise pas.
+const defaultChangeBatchSize = 100
+
+// applyChanges relit les lignes insérées ou modifiées, les rend et les
+// envoie à Qdrant par lots de batchSize ; les lignes supprimées (ou disparues
+// depuis) sont retirées de Qdrant par data_id.
+func applyChanges(ctx context.Context, db *sql.DB, plan scanPlan, r *renderer, upserts, deletes [][]string, batchSize int) (upserted, deleted int, err error) {
+	if batchSize <= 0 {
+		batchSize = defaultChangeBatchSize
+	}
+
+	var gone []string
+	for start := 0; start < len(upserts); start += batchSize {
+		chunk := upserts[start:min(start+batchSize, len(upserts))]
+		sent, missing, err := upsertRows(ctx, db, plan, r, chunk)
+		if err != nil {
+			return upserted, 0, err
+		}
+		upserted += sent
+		gone = append(gone, missing...)
+	}
+	for _, key := range deletes {
+		gone = append(gone, DataID(key))
+	}
+
+	for _, dataID := range gone {
+		if err := utils.DeleteFromQdrantByDataID(r.ownerID, r.source, dataID); err != nil {
+			return upserted, deleted, err
+		}
+		deleted++
+	}
+	return upserted, deleted, nil
+}
+
+// upsertRows relit un lot de lignes et les envoie en un seul appel à Qdrant.
+// Les data_id des lignes qui n'existent plus sont retournés dans gone.
+func upsertRows(ctx context.Context, db *sql.DB, plan scanPlan, r *renderer, keys [][]string) (sent int, gone []string, err error) {
+	rows, types, err := fetchRowsByKey(ctx, db, plan, keys)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(rows) > 0 {
+		if err := r.ensureIndexes(types); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var docs []utils.Document
+	for _, key := range keys {
+		dataID := DataID(key)
+		data, ok := rows[dataID]
+		if !ok {
+			gone = append(gone, dataID)
+			continue
+		}
+		doc, err := r.document(data, types, dataID)
+		if err != nil {
+			return 0, nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	if err := utils.SendBatchToQdrant(docs); err != nil {
+		return 0, nil, err
+	}
+	return len(docs), gone, nil
+}
@@ -0,0 +1,122 @@
+package vectorizer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDriver répond à toute requête avec les colonnes et lignes configurées,
+// et mémorise la dernière requête reçue.
+type fakeDriver struct {
+	columns   []string
+	rows      [][]driver.Value
+	lastQuery string
+	lastArgs  []driver.NamedValue
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.lastQuery, c.d.lastArgs = query, args
+	return &fakeRows{columns: c.d.columns, rows: c.d.rows}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func openFakeDB(t *testing.T, d *fakeDriver) *sql.DB {
+	t.Helper()
+	name := "fake-" + t.Name()
+	sql.Register(name, d)
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// Une clé timestamptz reçue du CDC (texte de sortie PostgreSQL) doit
+// retrouver la ligne relue, au lieu d'être traitée comme supprimée.
+func TestFetchRowsByKeyTimestampKey(t *testing.T) {
+	cdcKey := []string{"2024-01-02 10:00:00+00"}
+	d := &fakeDriver{
+		columns: []string{"__key_1", "created_at", "label"},
+		rows: [][]driver.Value{{
+			[]byte("2024-01-02 10:00:00+00"),
+			time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+			"premier",
+		}},
+	}
+	db := openFakeDB(t, d)
+	plan := scanPlan{table: "events", keys: []string{"created_at"}}
+
+	rows, _, err := fetchRowsByKey(context.Background(), db, plan, [][]string{cdcKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(d.lastQuery, `format('%s', "created_at") AS "__key_1"`) {
+		t.Errorf("la requête ne lit pas le texte de la clé : %s", d.lastQuery)
+	}
+	if len(d.lastArgs) != 1 || d.lastArgs[0].Value != cdcKey[0] {
+		t.Errorf("arguments inattendus : %v", d.lastArgs)
+	}
+
+	row, ok := rows[DataID(cdcKey)]
+	if !ok {
+		t.Fatalf("ligne introuvable pour %q parmi %v", DataID(cdcKey), rows)
+	}
+	if _, ok := row["__key_1"]; ok {
+		t.Error("la colonne de clé ajoutée doit être retirée de la ligne")
+	}
+	if row["label"] != "premier" {
+		t.Errorf("label = %v", row["label"])
+	}
+}
+
+// Le parcours complet produit le même data_id que le CDC pour une clé
+// composite timestamp / booléen.
+func TestRowKeyMatchesCDCText(t *testing.T) {
+	plan := scanPlan{table: "events", keys: []string{"created_at", "active"}}
+	data := map[string]interface{}{
+		"__key_1":    "2024-01-02 10:00:00+00",
+		"__key_2":    "t",
+		"created_at": time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+		"active":     true,
+	}
+
+	got := DataID(plan.rowKey(data))
+	want := DataID([]string{"2024-01-02 10:00:00+00", "t"})
+	if got != want {
+		t.Errorf("data_id = %s, attendu %s", got, want)
+	}
+	if len(data) != 2 {
+		t.Errorf("colonnes restantes : %v", data)
+	}
+}
@@ -0,0 +1,196 @@
+package vectorizer
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// ctidColumn est l'alias sous lequel la pseudo-colonne ctid est lue pour les
+// tables sans clé primaire.
+const ctidColumn = "__ctid"
+
+// getPrimaryKeys retourne les colonnes de la clé primaire dans l'ordre de
+// l'index. Une table sans clé primaire retourne une liste vide.
+func getPrimaryKeys(db *sql.DB, tableName string) ([]string, error) {
+	query := `
+		SELECT a.attname
+		FROM   pg_index i
+		JOIN   pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE  i.indrelid = $1::regclass AND i.indisprimary
+		ORDER  BY array_position(i.indkey::int2[], a.attnum);
+	`
+
+	rows, err := db.Query(query, pq.QuoteIdentifier(tableName))
+	if err != nil {
+		return nil, fmt.Errorf("clé primaire introuvable pour %s : %w", tableName, err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("erreur lecture clé primaire de %s : %w", tableName, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// scanPlan décrit comment parcourir une table par pagination keyset :
+// sur la clé primaire (éventuellement composite) ou, à défaut, sur ctid.
+type scanPlan struct {
+	table   string
+	keys    []string
+	useCtid bool
+}
+
+func newScanPlan(db *sql.DB, tableName string) (scanPlan, error) {
+	keys, err := getPrimaryKeys(db, tableName)
+	if err != nil {
+		return scanPlan{}, err
+	}
+	if len(keys) == 0 {
+		return scanPlan{table: tableName, keys: []string{ctidColumn}, useCtid: true}, nil
+	}
+	return scanPlan{table: tableName, keys: keys}, nil
+}
+
+// keyExpr retourne l'expression SQL comparée à la dernière clé lue.
+func (p scanPlan) keyExpr() string {
+	if p.useCtid {
+		return "ctid"
+	}
+	quoted := make([]string, len(p.keys))
+	for i, k := range p.keys {
+		quoted[i] = pq.QuoteIdentifier(k)
+	}
+	return "(" + strings.Join(quoted, ", ") + ")"
+}
+
+func (p scanPlan) orderBy() string {
+	if p.useCtid {
+		return "ctid"
+	}
+	quoted := make([]string, len(p.keys))
+	for i, k := range p.keys {
+		quoted[i] = pq.QuoteIdentifier(k)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// afterKey retourne la condition "clé > dernière clé" et ses arguments,
+// numérotés à partir de $firstArg.
+func (p scanPlan) afterKey(lastKey []string, firstArg int) (string, []interface{}) {
+	if p.useCtid {
+		return fmt.Sprintf("ctid > $%d::tid", firstArg), []interface{}{lastKey[0]}
+	}
+	placeholders := make([]string, len(lastKey))
+	args := make([]interface{}, len(lastKey))
+	for i, v := range lastKey {
+		placeholders[i] = fmt.Sprintf("$%d", firstArg+i)
+		args[i] = v
+	}
+	return p.keyExpr() + " > (" + strings.Join(placeholders, ", ") + ")", args
+}
+
+// keyText retourne l'expression SQL du texte d'une valeur de clé. format()
+// passe par la fonction de sortie du type, comme pgoutput : le texte est le
+// même pour le parcours, le CDC et les triggers NOTIFY (t pour un booléen,
+// là où ::text donnerait true).
+func keyText(expr string) string {
+	return "format('%s', " + expr + ")"
+}
+
+// keyAlias est l'alias sous lequel le texte de la colonne de clé i est lu.
+func keyAlias(i int) string {
+	return fmt.Sprintf("__key_%d", i+1)
+}
+
+// selectList retourne les colonnes lues, précédées du texte des colonnes de
+// clé (ou de ctid).
+func (p scanPlan) selectList() string {
+	if p.useCtid {
+		return "ctid::text AS " + pq.QuoteIdentifier(ctidColumn) + ", *"
+	}
+	keys := make([]string, len(p.keys))
+	for i, k := range p.keys {
+		keys[i] = keyText(pq.QuoteIdentifier(k)) + " AS " + pq.QuoteIdentifier(keyAlias(i))
+	}
+	return strings.Join(keys, ", ") + ", *"
+}
+
+// pageQuery construit la requête d'une page, avec des conditions
+// supplémentaires éventuelles (déjà numérotées) dans extra.
+func (p scanPlan) pageQuery(extra []string, pageSize int) string {
+	where := ""
+	if len(extra) > 0 {
+		where = " WHERE " + strings.Join(extra, " AND ")
+	}
+	return fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT %d",
+		p.selectList(), pq.QuoteIdentifier(p.table), where, p.orderBy(), pageSize)
+}
+
+// countQuery compte les lignes correspondant aux conditions extra.
+func (p scanPlan) countQuery(extra []string) string {
+	where := ""
+	if len(extra) > 0 {
+		where = " WHERE " + strings.Join(extra, " AND ")
+	}
+	return fmt.Sprintf("SELECT count(*) FROM %s%s", pq.QuoteIdentifier(p.table), where)
+}
+
+// rowKey extrait le texte des valeurs de clé d'une ligne lue avec
+// selectList, et retire de data les colonnes ajoutées pour la clé.
+func (p scanPlan) rowKey(data map[string]interface{}) []string {
+	if p.useCtid {
+		key := []string{formatKeyValue(data[ctidColumn])}
+		delete(data, ctidColumn)
+		return key
+	}
+	key := make([]string, len(p.keys))
+	for i := range p.keys {
+		key[i] = formatKeyValue(data[keyAlias(i)])
+		delete(data, keyAlias(i))
+	}
+	return key
+}
+
+// DataID construit l'identifiant de ligne stocké dans le payload Qdrant :
+// la valeur telle quelle pour une clé simple, un tableau JSON pour une clé
+// composite (les valeurs peuvent contenir des virgules).
+func DataID(key []string) string {
+	if len(key) == 1 {
+		return key[0]
+	}
+	b, _ := json.Marshal(key)
+	return string(b)
+}
+
+// scanRow lit la ligne courante dans une map colonne -> valeur.
+func scanRow(rows *sql.Rows, cols []string) (map[string]interface{}, error) {
+	values := make([]interface{}, len(cols))
+	valuePtrs := make([]interface{}, len(cols))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	if err := rows.Scan(valuePtrs...); err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]interface{})
+	for i, col := range cols {
+		val := values[i]
+		if b, ok := val.([]byte); ok {
+			data[col] = string(b)
+		} else {
+			data[col] = val
+		}
+	}
+	return data, nil
+}
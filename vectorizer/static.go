@@ -0,0 +1,271 @@
+package vectorizer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+
+	"github.com/RINOHeinrich1/postgres-vectorizer/models"
+	"github.com/RINOHeinrich1/postgres-vectorizer/utils"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/lib/pq"
+)
+
+const (
+	ModeFull   = "full"
+	ModeResume = "resume"
+	ModeSync   = "sync"
+)
+
+func connString(params models.ConnParams) string {
+	if params.SSLMode == "" {
+		params.SSLMode = "disable"
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		params.Host, params.Port, params.User, params.Password, params.DBName, params.SSLMode)
+}
+
+// OpenDB ouvre et vérifie la connexion PostgreSQL décrite par params.
+func OpenDB(ctx context.Context, params models.ConnParams) (*sql.DB, error) {
+	return openDB(ctx, "postgres", params)
+}
+
+// OpenQueryDB ouvre la connexion avec le driver pgx, qui expose la
+// description des lignes utilisée pour les métadonnées de colonnes des
+// requêtes en lecture seule (utils.StreamReadOnlyQuery).
+func OpenQueryDB(ctx context.Context, params models.ConnParams) (*sql.DB, error) {
+	return openDB(ctx, "pgx", params)
+}
+
+func openDB(ctx context.Context, driver string, params models.ConnParams) (*sql.DB, error) {
+	db, err := sql.Open(driver, connString(params))
+	if err != nil {
+		return nil, fmt.Errorf("erreur ouverture DB: %w", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("erreur connexion DB: %w", err)
+	}
+	return db, nil
+}
+
+// Source retourne l'identifiant "dbname/table" stocké dans le payload Qdrant.
+func Source(req models.FormatRequest) string {
+	return fmt.Sprintf("%s/%s", req.DBName, req.TableName)
+}
+
+// RunStatic parcourt la table (entièrement, depuis le checkpoint ou depuis le
+// watermark selon req.Mode), rend chaque ligne avec le template et envoie les
+// textes à Qdrant par lots, en rapportant l'avancement dans job. Une erreur est
+// retournée si un lot a échoué, après le parcours complet de la table.
+func RunStatic(ctx context.Context, job *Job, req models.FormatRequest, ownerID string) error {
+	r, err := newRenderer(req, ownerID)
+	if err != nil {
+		return err
+	}
+
+	db, err := OpenDB(ctx, req.ConnParams)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Pagination keyset sur la clé primaire, ou ctid si la table n'en a pas
+	plan, err := newScanPlan(db, req.TableName)
+	if err != nil {
+		return fmt.Errorf("erreur récupération clé primaire: %w", err)
+	}
+
+	store, err := DefaultStore()
+	if err != nil {
+		return err
+	}
+
+	source := Source(req)
+	if err := registerConnection(store, ownerID, req); err != nil {
+		return err
+	}
+
+	// Conditions communes à toutes les pages (fenêtre de synchronisation)
+	var baseConds []string
+	var baseArgs []interface{}
+
+	var lastKey []string
+	var newWatermark string
+	switch req.Mode {
+	case ModeResume:
+		// On repart de la dernière clé envoyée avec succès. Un checkpoint
+		// d'un parcours terminé ne laisse rien à reprendre : la table est
+		// alors reparcourue depuis le début.
+		cp, err := LoadCheckpoint(store, ownerID, source)
+		if err != nil {
+			return err
+		}
+		if cp != nil && !cp.Completed && slices.Equal(cp.KeyColumns, plan.keys) && len(cp.LastKey) == len(plan.keys) {
+			lastKey = cp.LastKey
+		}
+	case ModeSync:
+		// On ne retraite que les lignes plus récentes que le dernier watermark
+		previous, err := LoadWatermark(store, ownerID, source, req.WatermarkColumn)
+		if err != nil {
+			return err
+		}
+		conds, args, upper, ok, err := syncWindow(ctx, db, req.TableName, req.WatermarkColumn, previous)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			job.setTotal(0)
+			return nil
+		}
+		baseConds, baseArgs, newWatermark = conds, args, upper
+	default:
+		if err := deleteCheckpoint(store, ownerID, source); err != nil {
+			return err
+		}
+	}
+
+	// pageConds ajoute la condition keyset aux conditions communes
+	pageConds := func(lastKey []string) ([]string, []interface{}) {
+		conds := append([]string(nil), baseConds...)
+		args := append([]interface{}(nil), baseArgs...)
+		if lastKey != nil {
+			cond, a := plan.afterKey(lastKey, len(args)+1)
+			conds = append(conds, cond)
+			args = append(args, a...)
+		}
+		return conds, args
+	}
+
+	var total int
+	countConds, countArgs := pageConds(lastKey)
+	if err := db.QueryRowContext(ctx, plan.countQuery(countConds), countArgs...).Scan(&total); err != nil {
+		return fmt.Errorf("erreur comptage lignes: %w", err)
+	}
+	job.setTotal(total)
+
+	// Le checkpoint de reprise ne concerne que les parcours complets
+	trackCheckpoint := req.Mode != ModeSync
+
+	batchNum := 0
+	var pending []utils.Document
+	pendingLastKey := lastKey
+	// Dès qu'un lot échoue, le checkpoint n'avance plus : une reprise
+	// repartira de la dernière clé sûre.
+	failedBatches := 0
+
+	// Envoie les documents accumulés en un seul appel embedder + un seul Upsert
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		batchNum++
+		report := models.BatchReport{Batch: batchNum, Rows: len(pending)}
+		if err := utils.SendBatchToQdrant(pending); err != nil {
+			report.Error = err.Error()
+			failedBatches++
+		}
+		job.addBatch(report)
+		pending = pending[:0]
+
+		if failedBatches > 0 || !trackCheckpoint {
+			return nil
+		}
+		return saveCheckpoint(store, Checkpoint{
+			OwnerID:    ownerID,
+			Source:     source,
+			KeyColumns: plan.keys,
+			LastKey:    pendingLastKey,
+		})
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		conds, args := pageConds(lastKey)
+		rows, err := db.QueryContext(ctx, plan.pageQuery(conds, req.PageSize), args...)
+		if err != nil {
+			return fmt.Errorf("erreur requête SQL: %w", err)
+		}
+
+		cols, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("erreur récupération colonnes: %w", err)
+		}
+		types, err := columnTypes(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if err := r.ensureIndexes(types); err != nil {
+			rows.Close()
+			return err
+		}
+
+		count := 0
+
+		for rows.Next() {
+			data, err := scanRow(rows, cols)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("erreur scan ligne: %w", err)
+			}
+
+			key := plan.rowKey(data)
+
+			doc, err := r.document(data, types, DataID(key))
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			pending = append(pending, doc)
+			lastKey = key
+			pendingLastKey = key
+			if len(pending) >= req.BatchSize {
+				if err := flush(); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+
+			count++
+		}
+
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("erreur lecture lignes: %w", err)
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+
+		if count < req.PageSize {
+			break
+		}
+	}
+
+	if failedBatches > 0 {
+		// Le job se termine en échec ; le checkpoint permet de le reprendre
+		return fmt.Errorf("%d lot(s) en échec", failedBatches)
+	}
+	if req.Mode == ModeSync {
+		return saveWatermark(store, Watermark{
+			OwnerID: ownerID,
+			Source:  source,
+			Column:  req.WatermarkColumn,
+			Value:   newWatermark,
+		})
+	}
+	return saveCheckpoint(store, Checkpoint{
+		OwnerID:    ownerID,
+		Source:     source,
+		KeyColumns: plan.keys,
+		LastKey:    pendingLastKey,
+		Completed:  true,
+	})
+}
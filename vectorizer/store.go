@@ -0,0 +1,133 @@
+package vectorizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store persiste l'état du vectoriseur (checkpoints...) dans un fichier JSON local.
+type Store struct {
+	mu   sync.Mutex
+	path string
+	data map[string]json.RawMessage
+}
+
+// OpenStore charge le fichier path s'il existe.
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path, data: make(map[string]json.RawMessage)}
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erreur lecture %s : %w", path, err)
+	}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &s.data); err != nil {
+			return nil, fmt.Errorf("erreur parsing %s : %w", path, err)
+		}
+	}
+	return s, nil
+}
+
+var (
+	defaultStoreOnce sync.Once
+	defaultStore     *Store
+	defaultStoreErr  error
+)
+
+// DefaultStore ouvre le store désigné par VECTORIZER_STATE_FILE
+// (défaut : vectorizer_state.json).
+func DefaultStore() (*Store, error) {
+	defaultStoreOnce.Do(func() {
+		path := os.Getenv("VECTORIZER_STATE_FILE")
+		if path == "" {
+			path = "vectorizer_state.json"
+		}
+		defaultStore, defaultStoreErr = OpenStore(path)
+	})
+	return defaultStore, defaultStoreErr
+}
+
+// Get décode la valeur de key dans v. Retourne false si la clé est absente.
+func (s *Store) Get(key string, v interface{}) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	raw, ok := s.data[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, fmt.Errorf("erreur décodage %s : %w", key, err)
+	}
+	return true, nil
+}
+
+// Put enregistre v sous key et réécrit le fichier.
+func (s *Store) Put(key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("erreur encodage %s : %w", key, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = raw
+	return s.flush()
+}
+
+// Delete supprime key et réécrit le fichier.
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[key]; !ok {
+		return nil
+	}
+	delete(s.data, key)
+	return s.flush()
+}
+
+// Keys liste les clés commençant par prefix.
+func (s *Store) Keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for k := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// flush écrit le fichier de manière atomique (fichier temporaire + rename).
+func (s *Store) flush() error {
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("erreur encodage store : %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("erreur écriture store : %w", err)
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("erreur écriture store : %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("erreur écriture store : %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("erreur écriture store : %w", err)
+	}
+	return nil
+}
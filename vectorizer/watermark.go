@@ -0,0 +1,71 @@
+package vectorizer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Watermark mémorise la plus grande valeur de la colonne de suivi
+// (updated_at...) déjà vectorisée pour un couple propriétaire / source.
+type Watermark struct {
+	OwnerID   string    `json:"owner_id"`
+	Source    string    `json:"source"`
+	Column    string    `json:"column"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func watermarkKey(ownerID, source, column string) string {
+	return fmt.Sprintf("watermark/%s/%s/%s", ownerID, source, column)
+}
+
+// LoadWatermark retourne le watermark de ownerID/source/column s'il existe.
+func LoadWatermark(store *Store, ownerID, source, column string) (*Watermark, error) {
+	var wm Watermark
+	ok, err := store.Get(watermarkKey(ownerID, source, column), &wm)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &wm, nil
+}
+
+func saveWatermark(store *Store, wm Watermark) error {
+	wm.UpdatedAt = time.Now()
+	return store.Put(watermarkKey(wm.OwnerID, wm.Source, wm.Column), wm)
+}
+
+// syncWindow calcule la fenêtre ]previous, upper] des lignes à resynchroniser.
+// La borne haute est figée au début du traitement : les lignes modifiées
+// pendant le parcours seront reprises à la synchronisation suivante.
+// ok vaut false quand aucune ligne n'est plus récente que previous.
+func syncWindow(ctx context.Context, db *sql.DB, table, column string, previous *Watermark) (conds []string, args []interface{}, upper string, ok bool, err error) {
+	col := pq.QuoteIdentifier(column)
+
+	if previous != nil {
+		conds = append(conds, fmt.Sprintf("%s > $1", col))
+		args = append(args, previous.Value)
+	}
+
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + conds[0]
+	}
+
+	var max interface{}
+	query := fmt.Sprintf("SELECT max(%s) FROM %s%s", col, pq.QuoteIdentifier(table), where)
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&max); err != nil {
+		return nil, nil, "", false, fmt.Errorf("erreur lecture watermark %s : %w", column, err)
+	}
+	if max == nil {
+		return nil, nil, "", false, nil
+	}
+
+	upper = formatKeyValue(max)
+	conds = append(conds, fmt.Sprintf("%s <= $%d", col, len(args)+1))
+	args = append(args, upper)
+	return conds, args, upper, true, nil
+}